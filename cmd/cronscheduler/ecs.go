@@ -2,12 +2,18 @@ package main
 
 import (
 	"context"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
 )
 
 type ECSClient interface {
-	RunTask(ctx context.Context, input *ecs.RunTaskInput) error
+	// RunTask starts the tasks and returns their ARNs.
+	RunTask(ctx context.Context, input *ecs.RunTaskInput) ([]string, error)
+	// DescribeTasks returns the tasks that are still known to ECS.
+	DescribeTasks(ctx context.Context, cluster string, arns []string) ([]*ecs.Task, error)
+	StopTask(ctx context.Context, cluster string, arn string, reason string) error
 }
 
 func NewECSClient(sess *session.Session) ECSClient {
@@ -20,7 +26,37 @@ type ecsClient struct {
 	ecs *ecs.ECS
 }
 
-func (ecsClient *ecsClient) RunTask(ctx context.Context, input *ecs.RunTaskInput) error {
-	_, err := ecsClient.ecs.RunTask(input)
+func (ecsClient *ecsClient) RunTask(ctx context.Context, input *ecs.RunTaskInput) ([]string, error) {
+	out, err := ecsClient.ecs.RunTaskWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	arns := []string{}
+	for _, task := range out.Tasks {
+		arns = append(arns, aws.StringValue(task.TaskArn))
+	}
+	if len(arns) == 0 && len(out.Failures) > 0 {
+		return nil, errors.Errorf("no tasks were placed -- %s", aws.StringValue(out.Failures[0].Reason))
+	}
+	return arns, nil
+}
+
+func (ecsClient *ecsClient) DescribeTasks(ctx context.Context, cluster string, arns []string) ([]*ecs.Task, error) {
+	out, err := ecsClient.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   aws.StringSlice(arns),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Tasks, nil
+}
+
+func (ecsClient *ecsClient) StopTask(ctx context.Context, cluster string, arn string, reason string) error {
+	_, err := ecsClient.ecs.StopTaskWithContext(ctx, &ecs.StopTaskInput{
+		Cluster: aws.String(cluster),
+		Task:    aws.String(arn),
+		Reason:  aws.String(reason),
+	})
 	return err
 }
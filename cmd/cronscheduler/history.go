@@ -0,0 +1,204 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The statuses of a run.
+const (
+	RunRunning   = "Running"
+	RunSucceeded = "Succeeded"
+	RunFailed    = "Failed"
+	RunSkipped   = "Skipped"
+	RunUnknown   = "Unknown"
+)
+
+// The number of runs kept per job.
+const historyLimit = 20
+
+// A claim without tasks this old was left by a scheduler that stopped.
+const staleClaim = 10 * time.Minute
+
+// A cronRun claims one scheduled run of a job so that it is started at most
+// once, even when the scheduler stops before recording LastRun. It then keeps
+// the result of the run.
+type cronRun struct {
+	Job       string
+	Cluster   string
+	Scheduled time.Time
+
+	// The time the run was started.
+	Claimed time.Time
+
+	// The time the last task stopped.
+	Stopped time.Time
+
+	Tasks  []string
+	Status string
+	Reason string
+	Exits  []runExit
+}
+
+// runExit is how one container of a run exited.
+type runExit struct {
+	Task      string
+	Container string
+	ExitCode  *int64
+	Reason    string
+}
+
+func runKey(key string, scheduled time.Time) string {
+	return key + "/" + scheduled.UTC().Format(time.RFC3339)
+}
+
+// runJobKey returns the job of a run key. Job keys may hold a "/" so the job
+// is everything before the scheduled time, which must parse.
+func runJobKey(run string) (string, bool) {
+	i := strings.LastIndex(run, "/")
+	if i < 0 {
+		return "", false
+	}
+	if _, err := time.Parse(time.RFC3339, run[i+1:]); err != nil {
+		return "", false
+	}
+	return run[:i], true
+}
+
+// jobRuns returns the run keys of the job, oldest first.
+func jobRuns(runs []string, key string) []string {
+	found := []string{}
+	for _, run := range runs {
+		if job, ok := runJobKey(run); ok && job == key {
+			found = append(found, run)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// track removes all but the latest runs of the job and records the result of
+// runs whose tasks have stopped.
+func (scheduler *scheduler) track(key string, runs []string) {
+	if scheduler.finished == nil {
+		scheduler.finished = map[string]bool{}
+	}
+	if len(runs) > historyLimit {
+		for _, old := range runs[:len(runs)-historyLimit] {
+			scheduler.removeRun(old)
+		}
+		runs = runs[len(runs)-historyLimit:]
+	}
+
+	for _, runKey := range runs {
+		if scheduler.finished[runKey] {
+			continue
+		}
+		run := &cronRun{}
+		err := scheduler.kv.Get(scheduler.ctx, CronRunType, runKey, run)
+		if err != nil {
+			log.Printf("[WARN] scheduler: failed to read run %s -- %v", runKey, err)
+			continue
+		}
+
+		switch run.Status {
+		case "":
+			if GetTime().Sub(run.Claimed) < staleClaim {
+				continue
+			}
+			run.Status = RunUnknown
+			run.Reason = "The scheduler stopped before the tasks were recorded"
+		case RunRunning:
+			var tasks []*ecs.Task
+			if len(run.Tasks) > 0 {
+				tasks, err = scheduler.ecs.DescribeTasks(scheduler.ctx, run.Cluster, run.Tasks)
+				if err != nil {
+					log.Printf("[WARN] scheduler: failed to describe tasks of run %s -- %v", runKey, err)
+					continue
+				}
+			}
+			if !run.finish(tasks) {
+				continue
+			}
+		default:
+			scheduler.finished[runKey] = true
+			continue
+		}
+
+		log.Printf("[INFO] scheduler: run %s finished: %s", runKey, run.Status)
+		err = scheduler.kv.Put(scheduler.ctx, CronRunType, runKey, run)
+		if err != nil {
+			log.Printf("[WARN] scheduler: failed to record run %s -- %v", runKey, err)
+			continue
+		}
+		scheduler.finished[runKey] = true
+	}
+}
+
+// removeRuns removes the runs of jobs that no longer exist.
+func (scheduler *scheduler) removeRuns(jobs []string, runs []string) {
+	exists := map[string]bool{}
+	for _, key := range jobs {
+		exists[key] = true
+	}
+	for _, runKey := range runs {
+		if job, ok := runJobKey(runKey); ok && !exists[job] {
+			scheduler.removeRun(runKey)
+		}
+	}
+}
+
+func (scheduler *scheduler) removeRun(runKey string) {
+	err := scheduler.kv.Del(scheduler.ctx, CronRunType, runKey)
+	if err != nil {
+		log.Printf("[WARN] scheduler: failed to remove run %s -- %v", runKey, err)
+		return
+	}
+	delete(scheduler.finished, runKey)
+}
+
+// finish records the result once every task of the run has stopped. The run
+// failed when a container exited non-zero or did not exit at all.
+func (run *cronRun) finish(tasks []*ecs.Task) bool {
+	for _, task := range tasks {
+		if aws.StringValue(task.LastStatus) != ecs.DesiredStatusStopped {
+			return false
+		}
+	}
+
+	run.Status = RunSucceeded
+	run.Exits = nil
+	for _, task := range tasks {
+		if run.Reason == "" {
+			run.Reason = aws.StringValue(task.StoppedReason)
+		}
+		if task.StoppedAt != nil && task.StoppedAt.After(run.Stopped) {
+			run.Stopped = *task.StoppedAt
+		}
+		arn := aws.StringValue(task.TaskArn)
+		for _, c := range task.Containers {
+			run.Exits = append(run.Exits, runExit{
+				Task:      arn[strings.LastIndex(arn, "/")+1:],
+				Container: aws.StringValue(c.Name),
+				ExitCode:  c.ExitCode,
+				Reason:    aws.StringValue(c.Reason),
+			})
+			if c.ExitCode == nil || *c.ExitCode != 0 {
+				run.Status = RunFailed
+			}
+		}
+	}
+	if len(run.Tasks) == 0 {
+		run.Status = RunUnknown
+		run.Reason = "No tasks were started"
+	} else if len(tasks) < len(run.Tasks) && run.Status == RunSucceeded {
+		// Stopped tasks are only described by ECS for a while.
+		run.Status = RunUnknown
+		run.Reason = "Some tasks are no longer known to ECS"
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCronRun_Finish(t *testing.T) {
+	stopped := func(arn string, codes ...int64) *ecs.Task {
+		task := &ecs.Task{
+			TaskArn:       aws.String(arn),
+			LastStatus:    aws.String("STOPPED"),
+			StoppedReason: aws.String("Essential container in task exited"),
+		}
+		for i, code := range codes {
+			task.Containers = append(task.Containers, &ecs.Container{
+				Name:     aws.String(fmt.Sprintf("c%d", i)),
+				ExitCode: aws.Int64(code),
+			})
+		}
+		return task
+	}
+
+	run := &cronRun{Tasks: []string{"arn/a", "arn/b"}}
+	assert.False(t, run.finish([]*ecs.Task{stopped("arn/a", 0), {TaskArn: aws.String("arn/b"), LastStatus: aws.String("RUNNING")}}))
+
+	assert.True(t, run.finish([]*ecs.Task{stopped("arn/a", 0), stopped("arn/b", 0, 0)}))
+	assert.Equal(t, RunSucceeded, run.Status)
+	assert.Equal(t, 3, len(run.Exits))
+	assert.Equal(t, "b", run.Exits[1].Task)
+
+	run = &cronRun{Tasks: []string{"arn/a", "arn/b"}}
+	assert.True(t, run.finish([]*ecs.Task{stopped("arn/a", 0), stopped("arn/b", 1)}))
+	assert.Equal(t, RunFailed, run.Status)
+	assert.Equal(t, "Essential container in task exited", run.Reason)
+
+	run = &cronRun{Tasks: []string{"arn/a", "arn/b"}}
+	assert.True(t, run.finish([]*ecs.Task{stopped("arn/a", 0)}))
+	assert.Equal(t, RunUnknown, run.Status)
+}
+
+func TestScheduler_Track(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{ctx: ctx, ecs: mockEcs, kv: kv.NewLocalDB()}
+
+	for i := 0; i < historyLimit+2; i++ {
+		scheduled := GetTime().Add(time.Duration(i-historyLimit-2) * time.Hour)
+		sched.kv.Put(ctx, CronRunType, runKey("job1", scheduled), &cronRun{
+			Job:       "job1",
+			Cluster:   "testCluster",
+			Scheduled: scheduled,
+			Status:    RunSucceeded,
+		})
+	}
+	latest := runKey("job1", GetTime().Add(-time.Hour))
+	sched.kv.Put(ctx, CronRunType, latest, &cronRun{
+		Job:     "job1",
+		Cluster: "testCluster",
+		Tasks:   []string{"arn/a"},
+		Status:  RunRunning,
+	})
+	mockEcs.On("DescribeTasks", "testCluster", []string{"arn/a"}).Return([]*ecs.Task{{
+		TaskArn:    aws.String("arn/a"),
+		LastStatus: aws.String("STOPPED"),
+		Containers: []*ecs.Container{{Name: aws.String("app"), ExitCode: aws.Int64(2)}},
+	}}, nil)
+
+	keys, _ := sched.kv.Keys(ctx, CronRunType)
+	sched.track("job1", jobRuns(keys, "job1"))
+
+	keys, _ = sched.kv.Keys(ctx, CronRunType)
+	assert.Equal(t, historyLimit, len(keys))
+	run := &cronRun{}
+	sched.kv.Get(ctx, CronRunType, latest, run)
+	assert.Equal(t, RunFailed, run.Status)
+	assert.Equal(t, []runExit{{Task: "a", Container: "app", ExitCode: aws.Int64(2)}}, run.Exits)
+
+	// Finished runs are not read again.
+	run.Status = RunRunning
+	sched.kv.Put(ctx, CronRunType, latest, run)
+	sched.track("job1", jobRuns(keys, "job1"))
+	mockEcs.AssertNumberOfCalls(t, "DescribeTasks", 1)
+}
+
+func TestScheduler_RemoveRuns(t *testing.T) {
+	ctx := context.Background()
+	sched := &scheduler{ctx: ctx, kv: kv.NewLocalDB()}
+	sched.kv.Put(ctx, CronJobType, "job1", &CronJob{Schedule: "0 * * * *"})
+	sched.kv.Put(ctx, CronRunType, runKey("job1", GetTime()), &cronRun{Job: "job1"})
+	sched.kv.Put(ctx, CronRunType, runKey("job10", GetTime()), &cronRun{Job: "job10"})
+
+	sched.evaluate()
+
+	keys, _ := sched.kv.Keys(ctx, CronRunType)
+	assert.Equal(t, []string{runKey("job1", GetTime())}, keys)
+}
+
+func TestJobRuns_Nested(t *testing.T) {
+	runs := []string{"a/2017-05-04T02:00:00Z", "a/b/2017-05-04T01:00:00Z", "a/2017-05-04T01:00:00Z", "ab/2017-05-04T01:00:00Z"}
+	assert.Equal(t, []string{"a/2017-05-04T01:00:00Z", "a/2017-05-04T02:00:00Z"}, jobRuns(runs, "a"))
+	assert.Equal(t, []string{"a/b/2017-05-04T01:00:00Z"}, jobRuns(runs, "a/b"))
+
+	// Removing the runs of a deleted job keeps those of a/b.
+	ctx := context.Background()
+	sched := &scheduler{ctx: ctx, kv: kv.NewLocalDB()}
+	for _, run := range runs {
+		sched.kv.Put(ctx, CronRunType, run, &cronRun{})
+	}
+	sched.removeRuns([]string{"a/b"}, runs)
+	keys, _ := sched.kv.Keys(ctx, CronRunType)
+	assert.Equal(t, []string{"a/b/2017-05-04T01:00:00Z"}, keys)
+}
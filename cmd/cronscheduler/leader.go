@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"log"
+	"sync"
+	"time"
+)
+
+const leaderLease = "cronscheduler"
+
+// leader holds the scheduler lease in the kv store. The lease is renewed every
+// ttl/3, a standby takes over at most ttl + ttl/3 after the leader stops.
+type leader struct {
+	kv  kv.DB
+	id  string
+	ttl time.Duration
+
+	// The local time the held lease expires at, zero when not held. Guarded
+	// by mu as the lease is renewed while jobs run.
+	mu      sync.Mutex
+	expires time.Time
+}
+
+// campaign acquires or renews the lease.
+func (l *leader) campaign(ctx context.Context) {
+	start := GetTime()
+	ok, err := l.kv.Acquire(ctx, leaderLease, l.id, l.ttl)
+	if err != nil {
+		log.Printf("[WARN] leader: failed to acquire lease -- %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !ok {
+		if !l.expires.IsZero() {
+			log.Printf("[WARN] leader: lost lease")
+		}
+		l.expires = time.Time{}
+		return
+	}
+	if l.expires.IsZero() {
+		log.Printf("[INFO] leader: acquired lease as %s", l.id)
+	}
+	// Count from before the write so the lease is never assumed longer
+	// than it is stored for.
+	l.expires = start.Add(l.ttl)
+}
+
+// renew campaigns every ttl/3 until the context is cancelled, separately from
+// the jobs so that a slow evaluation does not let the lease expire.
+func (l *leader) renew(ctx context.Context) {
+	heartbeat := time.NewTicker(l.ttl / 3)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			l.campaign(ctx)
+		}
+	}
+}
+
+// isLeader returns true while the lease is held.
+func (l *leader) isLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return GetTime().Before(l.expires)
+}
+
+func (l *leader) release(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.expires.IsZero() {
+		return
+	}
+	err := l.kv.Release(ctx, leaderLease, l.id)
+	if err != nil {
+		log.Printf("[WARN] leader: failed to release lease -- %v", err)
+	}
+	l.expires = time.Time{}
+}
@@ -3,20 +3,34 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/coldog/tool-ecs/internal/kv"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 )
 
-var region string
+var (
+	region   string
+	id       string
+	leaseTTL time.Duration
+)
 
 func main() {
+	hostname, _ := os.Hostname()
 	flag.StringVar(&region, "region", "us-west-2", "Aws Region")
+	flag.StringVar(&id, "id", fmt.Sprintf("%s-%d", hostname, os.Getpid()), "Unique ID of this replica")
+	flag.DurationVar(&leaseTTL, "lease-ttl", 30*time.Second, "Time a standby waits before taking over from a stopped leader")
 	flag.Parse()
 
+	if leaseTTL < 3*time.Second {
+		log.Fatalf("[FATA] main: -lease-ttl must be at least 3s, got %s", leaseTTL)
+	}
+
 	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
 	if err != nil {
 		log.Fatalf("[FATA] main: could not connect to aws -- %v", err)
@@ -33,16 +47,20 @@ func main() {
 		ctx: ctx,
 		kv:  db,
 		ecs: NewECSClient(sess),
+		leader: &leader{
+			kv:  db,
+			id:  id,
+			ttl: leaseTTL,
+		},
 	}
 
-	sigs := make(chan os.Signal)
-	signal.Notify(sigs, os.Interrupt, os.Kill)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		sig := <-sigs
 		log.Printf("[WARN] main: exiting due to %v", sig)
 		cancel()
-		os.Exit(0)
 	}()
 
 	sched.run()
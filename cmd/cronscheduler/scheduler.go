@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/coldog/tool-ecs/internal/kv"
@@ -13,7 +14,38 @@ import (
 
 var GetTime = func() time.Time { return time.Now() }
 
-const CronJobType = "CronJob"
+const (
+	CronJobType = "CronJob"
+	CronRunType = "CronRun"
+)
+
+// Misfire policies decide what happens to runs missed while no scheduler was
+// running.
+const (
+	// Drop missed runs, only a run that is due now is started.
+	MisfireSkip = "skip"
+	// Start the latest missed run once, this is the default.
+	MisfireRunOnce = "runOnce"
+	// Start every missed run, up to MisfireLimit.
+	MisfireRunAll = "runAll"
+)
+
+// Concurrency policies decide what happens when a run is due while the tasks
+// of the previous run are still running.
+const (
+	// Start the new run next to the previous one, this is the default.
+	ConcurrencyAllow = "Allow"
+	// Skip the new run.
+	ConcurrencyForbid = "Forbid"
+	// Stop the previous tasks and start the new run.
+	ConcurrencyReplace = "Replace"
+)
+
+// The number of missed runs runAll starts when MisfireLimit is not set.
+const defaultMisfireLimit = 10
+
+// The scheduler evaluates jobs every minute, a run later than this was missed.
+const onTime = 2 * time.Minute
 
 // A cron job represents a runnable cron job
 type CronJob struct {
@@ -32,6 +64,26 @@ type CronJob struct {
 
 	// A Cron string.
 	Schedule string
+
+	// One of skip, runOnce or runAll, runOnce when empty.
+	MisfirePolicy string
+
+	// The most missed runs started by runAll, the latest are kept.
+	MisfireLimit int
+
+	// Runs that are later than this are not started, 0 for no deadline.
+	StartingDeadlineSeconds int
+
+	// One of Allow, Forbid or Replace, Allow when empty.
+	ConcurrencyPolicy string
+
+	// The task ARNs started by the last run.
+	Tasks []string
+
+	// Set by ecs apply to mark the job as managed, declared so they are kept
+	// when the job is written.
+	ManagedBy   string
+	ManifestSet string
 }
 
 func (job *CronJob) Next() (time.Time, error) {
@@ -47,31 +99,181 @@ func (job *CronJob) Next() (time.Time, error) {
 }
 
 func (job *CronJob) ShouldRun() (bool, error) {
-	next, err := job.Next()
+	due, _, err := job.Due()
 	if err != nil {
 		return false, err
 	}
-	return GetTime().After(next), nil
+	return len(due) > 0, nil
+}
+
+// Due returns the scheduled times to start now, oldest first, following the
+// misfire policy and starting deadline. The latest scheduled time that has
+// passed is returned as well, it is zero when no run was scheduled.
+func (job *CronJob) Due() ([]time.Time, time.Time, error) {
+	if job.LastRun.IsZero() {
+		job.LastRun = GetTime()
+	}
+	expr, err := cronexpr.Parse(job.Schedule)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	limit := 1
+	switch job.MisfirePolicy {
+	case "", MisfireSkip, MisfireRunOnce:
+	case MisfireRunAll:
+		limit = job.MisfireLimit
+		if limit <= 0 {
+			limit = defaultMisfireLimit
+		}
+	default:
+		return nil, time.Time{}, errors.Errorf("unknown misfire policy %q", job.MisfirePolicy)
+	}
+
+	now := GetTime()
+	latest := []time.Time{}
+	for t := expr.Next(job.LastRun); !t.IsZero() && now.After(t); t = expr.Next(t) {
+		latest = append(latest, t)
+		if len(latest) > limit {
+			latest = latest[1:]
+		}
+	}
+	if len(latest) == 0 {
+		return nil, time.Time{}, nil
+	}
+	last := latest[len(latest)-1]
+
+	deadline := time.Duration(job.StartingDeadlineSeconds) * time.Second
+	if job.MisfirePolicy == MisfireSkip && (deadline == 0 || deadline > onTime) {
+		deadline = onTime
+	}
+	due := []time.Time{}
+	for _, t := range latest {
+		if deadline == 0 || now.Sub(t) <= deadline {
+			due = append(due, t)
+		}
+	}
+	return due, last, nil
 }
 
 type scheduler struct {
 	ctx context.Context
 	kv  kv.DB
 	ecs ECSClient
+	// Nil when jobs are evaluated without leader election.
+	leader *leader
+
+	// Runs known to have a final status, which track does not read again.
+	finished map[string]bool
 }
 
-func (scheduler *scheduler) runJob(key string, job *CronJob) error {
-	shouldRun, err := job.ShouldRun()
+func (scheduler *scheduler) runJob(key string, job *CronJob, version int64) error {
+	if job.LastRun.IsZero() {
+		// New jobs are scheduled from the first time they are seen.
+		return scheduler.recordRun(key, job, version, nil)
+	}
+	due, last, err := job.Due()
 	if err != nil {
 		return err
 	}
-	if !shouldRun {
+	if last.IsZero() {
 		return nil
 	}
+	if len(due) == 0 || due[len(due)-1] != last {
+		log.Printf("[INFO] scheduler: skipping missed runs of %s up to %v", key, last)
+	}
+
+	// The tasks the run replaces, stopped once the run is claimed.
+	var replace []string
+	if len(due) > 0 && job.ConcurrencyPolicy != "" && job.ConcurrencyPolicy != ConcurrencyAllow {
+		// Runs must not overlap, so only the latest is considered.
+		due = due[len(due)-1:]
+		running, err := scheduler.running(job)
+		if err != nil {
+			return err
+		}
+		switch job.ConcurrencyPolicy {
+		case ConcurrencyForbid:
+			if len(running) > 0 {
+				log.Printf("[INFO] scheduler: skipping run of %s, %d tasks are still running", key, len(running))
+				scheduler.kv.PutVersion(scheduler.ctx, CronRunType, runKey(key, due[0]), &cronRun{
+					Job:       key,
+					Cluster:   job.Cluster,
+					Scheduled: due[0],
+					Claimed:   GetTime(),
+					Status:    RunSkipped,
+					Reason:    fmt.Sprintf("%d tasks of the previous run were still running", len(running)),
+				}, 0)
+				return scheduler.recordRun(key, job, version, nil)
+			}
+		case ConcurrencyReplace:
+			replace = running
+		default:
+			return errors.Errorf("unknown concurrency policy %q", job.ConcurrencyPolicy)
+		}
+	}
+
+	var tasks []string
+	for _, scheduled := range due {
+		arns, err := scheduler.start(key, job, scheduled, replace)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, arns...)
+	}
+	return scheduler.recordRun(key, job, version, tasks)
+}
+
+// running returns the tasks of the last run that have not stopped.
+func (scheduler *scheduler) running(job *CronJob) ([]string, error) {
+	if len(job.Tasks) == 0 {
+		return nil, nil
+	}
+	tasks, err := scheduler.ecs.DescribeTasks(scheduler.ctx, job.Cluster, job.Tasks)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe tasks")
+	}
+	running := []string{}
+	for _, task := range tasks {
+		if aws.StringValue(task.LastStatus) != ecs.DesiredStatusStopped {
+			running = append(running, aws.StringValue(task.TaskArn))
+		}
+	}
+	return running, nil
+}
+
+// start claims the run scheduled at the time, stops the tasks it replaces and
+// starts the job, returning the started tasks. A claim that already exists
+// means the run was started before, nothing is stopped then.
+func (scheduler *scheduler) start(key string, job *CronJob, scheduled time.Time, replace []string) ([]string, error) {
+	run := &cronRun{
+		Job:       key,
+		Cluster:   job.Cluster,
+		Scheduled: scheduled,
+		Claimed:   GetTime(),
+	}
+	claim := runKey(key, scheduled)
+	err := scheduler.kv.PutVersion(scheduler.ctx, CronRunType, claim, run, 0)
+	if err == kv.ErrConflict {
+		log.Printf("[INFO] scheduler: run of %s at %v was already started", key, scheduled)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim run")
+	}
+
+	for _, arn := range replace {
+		log.Printf("[INFO] scheduler: stopping task %s of %s", arn, key)
+		err = scheduler.ecs.StopTask(scheduler.ctx, job.Cluster, arn, "Replaced by the next run of "+key)
+		if err != nil {
+			scheduler.fail(claim, run, fmt.Sprintf("Failed to stop task %s: %v", arn, err))
+			return nil, errors.Wrap(err, "failed to stop task")
+		}
+	}
 
 	log.Printf("[INFO] scheduler: running task %s/%s", job.Cluster, job.TaskDefinitionID)
 
-	err = scheduler.ecs.RunTask(scheduler.ctx, &ecs.RunTaskInput{
+	arns, err := scheduler.ecs.RunTask(scheduler.ctx, &ecs.RunTaskInput{
 		Cluster:        aws.String(job.Cluster),
 		TaskDefinition: aws.String(job.TaskDefinitionID),
 		StartedBy:      aws.String("CronScheduler"),
@@ -81,16 +283,56 @@ func (scheduler *scheduler) runJob(key string, job *CronJob) error {
 		},
 	})
 	if err != nil {
-		return errors.Wrap(err, "failed to run job")
+		// Tasks may have started when the call failed, so the claim is kept
+		// and the run is not tried again.
+		scheduler.fail(claim, run, fmt.Sprintf("Failed to run task: %v", err))
+		return nil, errors.Wrap(err, "failed to run job")
 	}
 
-	job.LastRun = GetTime()
-	err = scheduler.kv.Put(scheduler.ctx, CronJobType, key, job)
+	run.Tasks = arns
+	run.Status = RunRunning
+	err = scheduler.kv.Put(scheduler.ctx, CronRunType, claim, run)
 	if err != nil {
-		return errors.Wrap(err, "failed to update timestamp")
+		log.Printf("[WARN] scheduler: failed to record run of %s -- %v", key, err)
 	}
+	return arns, nil
+}
 
-	return nil
+// fail records the claimed run as failed, it is not started again.
+func (scheduler *scheduler) fail(claim string, run *cronRun, reason string) {
+	run.Status = RunFailed
+	run.Reason = reason
+	err := scheduler.kv.Put(scheduler.ctx, CronRunType, claim, run)
+	if err != nil {
+		log.Printf("[WARN] scheduler: failed to record run %s -- %v", claim, err)
+	}
+}
+
+// recordRun sets LastRun on the job, and Tasks when tasks were started. When
+// the job was written since it was read, for example by an apply, it is read
+// again so the write is kept.
+func (scheduler *scheduler) recordRun(key string, job *CronJob, version int64, tasks []string) error {
+	lastRun := GetTime()
+	for i := 0; i < 3; i++ {
+		job.LastRun = lastRun
+		if tasks != nil {
+			job.Tasks = tasks
+		}
+		err := scheduler.kv.PutVersion(scheduler.ctx, CronJobType, key, job, version)
+		if err != kv.ErrConflict {
+			return errors.Wrap(err, "failed to update timestamp")
+		}
+
+		job = &CronJob{}
+		version, err = scheduler.kv.GetVersion(scheduler.ctx, CronJobType, key, job)
+		if err == kv.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to update timestamp")
+		}
+	}
+	return errors.New("failed to update timestamp: job is changing concurrently")
 }
 
 func (scheduler *scheduler) evaluate() {
@@ -99,30 +341,72 @@ func (scheduler *scheduler) evaluate() {
 		log.Printf("[WARN] scheduler: failed to read keys -- %v", err)
 		return
 	}
+	runs, err := scheduler.kv.Keys(scheduler.ctx, CronRunType)
+	if err != nil {
+		log.Printf("[WARN] scheduler: failed to read runs -- %v", err)
+		return
+	}
 
 	for _, key := range keys {
+		// The lease may have been lost while earlier jobs were started.
+		if !scheduler.isLeader() {
+			log.Printf("[WARN] scheduler: lost the lease, skipping the remaining jobs")
+			return
+		}
+
 		job := &CronJob{}
-		err := scheduler.kv.Get(scheduler.ctx, CronJobType, key, job)
+		version, err := scheduler.kv.GetVersion(scheduler.ctx, CronJobType, key, job)
 		if err != nil {
 			log.Printf("[WARN] scheduler: failed to run job %s -- %v", key, err)
 			continue
 		}
 
 		log.Printf("[DEBU] scheduler: evaluating job %+v", job)
-		err = scheduler.runJob(key, job)
+		err = scheduler.runJob(key, job, version)
 		if err != nil {
 			log.Printf("[WARN] scheduler: failed to run job %s -- %v", key, err)
+			continue
 		}
+		scheduler.track(key, jobRuns(runs, key))
 	}
+	scheduler.removeRuns(keys, runs)
 }
 
+// isLeader returns true while jobs may be evaluated, always without a leader.
+func (scheduler *scheduler) isLeader() bool {
+	return scheduler.leader == nil || scheduler.leader.isLeader()
+}
+
+// run evaluates the jobs every minute while this process holds the leader
+// lease. The lease is released when the context is cancelled.
 func (scheduler *scheduler) run() {
+	tick := time.NewTicker(1 * time.Minute)
+	defer tick.Stop()
+
+	renewed := make(chan struct{})
+	if scheduler.leader != nil {
+		scheduler.leader.campaign(scheduler.ctx)
+		go func() {
+			scheduler.leader.renew(scheduler.ctx)
+			close(renewed)
+		}()
+	} else {
+		close(renewed)
+	}
+
 	for {
 		select {
 		case <-scheduler.ctx.Done():
+			// Wait for the renewal to stop so the lease is not taken again.
+			<-renewed
+			if scheduler.leader != nil {
+				scheduler.leader.release(context.Background())
+			}
 			return
-		case <-time.After(1 * time.Minute):
-			scheduler.evaluate()
+		case <-tick.C:
+			if scheduler.isLeader() {
+				scheduler.evaluate()
+			}
 		}
 	}
 }
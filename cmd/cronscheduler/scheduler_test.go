@@ -5,6 +5,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"testing"
@@ -23,8 +24,18 @@ type MockECS struct {
 }
 
 func (m *MockECS) Open(ctx context.Context) error { return nil }
-func (m *MockECS) RunTask(ctx context.Context, input *ecs.RunTaskInput) error {
-	return m.Called(input).Error(0)
+func (m *MockECS) RunTask(ctx context.Context, input *ecs.RunTaskInput) ([]string, error) {
+	args := m.Called(input)
+	arns, _ := args.Get(0).([]string)
+	return arns, args.Error(1)
+}
+func (m *MockECS) DescribeTasks(ctx context.Context, cluster string, arns []string) ([]*ecs.Task, error) {
+	args := m.Called(cluster, arns)
+	tasks, _ := args.Get(0).([]*ecs.Task)
+	return tasks, args.Error(1)
+}
+func (m *MockECS) StopTask(ctx context.Context, cluster string, arn string, reason string) error {
+	return m.Called(cluster, arn).Error(0)
 }
 
 func TestCronJob_Next(t *testing.T) {
@@ -85,7 +96,7 @@ func TestScheduler_Start(t *testing.T) {
 		Cluster:        aws.String("testCluster"),
 		Overrides:      &ecs.TaskOverride{},
 	}
-	mockEcs.On("RunTask", input).Return(nil)
+	mockEcs.On("RunTask", input).Return([]string{"task1"}, nil)
 
 	sched.evaluate()
 
@@ -106,9 +117,352 @@ func TestScheduler_DoNotStart(t *testing.T) {
 		Cluster:          "testCluster",
 		Schedule:         "0 * * * *",
 	})
-	mockEcs.On("RunTask", "testCluster", "testTask").Return(nil)
+	mockEcs.On("RunTask", "testCluster", "testTask").Return(nil, nil)
 
 	sched.evaluate()
 
 	mockEcs.AssertNotCalled(t, "RunTask")
 }
+
+func TestLeader_Campaign(t *testing.T) {
+	ctx := context.Background()
+	db := kv.NewLocalDB()
+	a := &leader{kv: db, id: "a", ttl: time.Minute}
+	b := &leader{kv: db, id: "b", ttl: time.Minute}
+
+	a.campaign(ctx)
+	b.campaign(ctx)
+	assert.True(t, a.isLeader())
+	assert.False(t, b.isLeader())
+
+	// The standby takes over once the leader releases the lease.
+	a.release(ctx)
+	assert.False(t, a.isLeader())
+	b.campaign(ctx)
+	a.campaign(ctx)
+	assert.True(t, b.isLeader())
+	assert.False(t, a.isLeader())
+}
+
+func TestScheduler_LostLease(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	db := kv.NewLocalDB()
+	l := &leader{kv: db, id: "a", ttl: time.Minute}
+	sched := &scheduler{ctx: ctx, ecs: mockEcs, kv: db, leader: l}
+	db.Put(ctx, CronJobType, "job1", &CronJob{
+		LastRun:          time.Date(2017, 05, 04, 0, 0, 0, 0, time.UTC),
+		TaskDefinitionID: "testTask",
+		Cluster:          "testCluster",
+		Schedule:         "0 * * * *",
+	})
+
+	// The lease expired before the job was reached.
+	sched.evaluate()
+	mockEcs.AssertNotCalled(t, "RunTask", mock.Anything)
+
+	mockEcs.On("RunTask", mock.Anything).Return(nil, nil)
+	l.campaign(ctx)
+	sched.evaluate()
+	mockEcs.AssertNumberOfCalls(t, "RunTask", 1)
+}
+
+func TestScheduler_RunWithoutLeader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sched := &scheduler{ctx: ctx, ecs: &MockECS{}, kv: kv.NewLocalDB()}
+
+	assert.True(t, sched.isLeader())
+	sched.run()
+}
+
+func TestScheduler_ClaimedRun(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{
+		ctx: ctx,
+		ecs: mockEcs,
+		kv:  kv.NewLocalDB(),
+	}
+	job := &CronJob{
+		LastRun:          time.Date(2017, 05, 04, 0, 0, 0, 0, time.UTC),
+		TaskDefinitionID: "testTask",
+		Cluster:          "testCluster",
+		Schedule:         "0 * * * *",
+	}
+	sched.kv.Put(ctx, CronJobType, "job1", job)
+
+	// The latest run was started before a crash but LastRun was not recorded.
+	scheduled := time.Date(2017, 05, 04, 23, 0, 0, 0, time.UTC)
+	sched.kv.Put(ctx, CronRunType, runKey("job1", scheduled), &cronRun{Job: "job1", Scheduled: scheduled})
+
+	sched.evaluate()
+
+	mockEcs.AssertNotCalled(t, "RunTask", mock.Anything)
+	stored := &CronJob{}
+	sched.kv.Get(ctx, CronJobType, "job1", stored)
+	assert.Equal(t, GetTime(), stored.LastRun)
+}
+
+func TestScheduler_RunTaskFailed(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{
+		ctx: ctx,
+		ecs: mockEcs,
+		kv:  kv.NewLocalDB(),
+	}
+	sched.kv.Put(ctx, CronJobType, "job1", &CronJob{
+		LastRun:          time.Date(2017, 05, 04, 22, 30, 0, 0, time.UTC),
+		TaskDefinitionID: "testTask",
+		Cluster:          "testCluster",
+		Schedule:         "0 * * * *",
+	})
+	mockEcs.On("RunTask", mock.Anything).Return(nil, errors.New("timeout"))
+
+	// The failed run keeps its claim and is not started again.
+	sched.evaluate()
+	sched.evaluate()
+
+	mockEcs.AssertNumberOfCalls(t, "RunTask", 1)
+	run := &cronRun{}
+	assert.Nil(t, sched.kv.Get(ctx, CronRunType, "job1/2017-05-04T23:00:00Z", run))
+	assert.Equal(t, RunFailed, run.Status)
+	assert.Equal(t, "Failed to run task: timeout", run.Reason)
+}
+
+func TestScheduler_ConcurrentUpdate(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{
+		ctx: ctx,
+		ecs: mockEcs,
+		kv:  kv.NewLocalDB(),
+	}
+	job := &CronJob{
+		LastRun:          time.Date(2017, 05, 04, 0, 0, 0, 0, time.UTC),
+		TaskDefinitionID: "testTask",
+		Cluster:          "testCluster",
+		Schedule:         "0 * * * *",
+	}
+	sched.kv.Put(ctx, CronJobType, "job1", job)
+	version, _ := sched.kv.GetVersion(ctx, CronJobType, "job1", &CronJob{})
+
+	// The schedule is changed after the scheduler read the job.
+	sched.kv.Put(ctx, CronJobType, "job1", &CronJob{
+		LastRun:          job.LastRun,
+		TaskDefinitionID: "testTask",
+		Cluster:          "testCluster",
+		Schedule:         "30 * * * *",
+	})
+	mockEcs.On("RunTask", mock.Anything).Return(nil, nil).Once()
+
+	assert.Nil(t, sched.runJob("job1", job, version))
+
+	stored := &CronJob{}
+	sched.kv.Get(ctx, CronJobType, "job1", stored)
+	assert.Equal(t, "30 * * * *", stored.Schedule)
+	assert.Equal(t, GetTime(), stored.LastRun)
+
+	// The same tick is not started twice.
+	assert.Nil(t, sched.runJob("job1", job, version))
+	mockEcs.AssertNumberOfCalls(t, "RunTask", 1)
+}
+
+func TestCronJob_Due(t *testing.T) {
+	hour := func(h int) time.Time { return time.Date(2017, 05, 04, h, 0, 0, 0, time.UTC) }
+	for _, test := range []struct {
+		name     string
+		job      *CronJob
+		expected []time.Time
+	}{
+		{
+			name:     "runOnce starts the latest missed run",
+			job:      &CronJob{LastRun: hour(20)},
+			expected: []time.Time{hour(23)},
+		},
+		{
+			name:     "runAll starts every missed run",
+			job:      &CronJob{LastRun: hour(20), MisfirePolicy: MisfireRunAll},
+			expected: []time.Time{hour(21), hour(22), hour(23)},
+		},
+		{
+			name:     "runAll keeps the latest runs up to the limit",
+			job:      &CronJob{LastRun: hour(20), MisfirePolicy: MisfireRunAll, MisfireLimit: 2},
+			expected: []time.Time{hour(22), hour(23)},
+		},
+		{
+			name:     "runAll drops runs past the deadline",
+			job:      &CronJob{LastRun: hour(20), MisfirePolicy: MisfireRunAll, StartingDeadlineSeconds: 7200},
+			expected: []time.Time{hour(22), hour(23)},
+		},
+		{
+			name:     "runOnce drops a run past the deadline",
+			job:      &CronJob{LastRun: hour(20), StartingDeadlineSeconds: 1800},
+			expected: []time.Time{},
+		},
+		{
+			name:     "skip drops missed runs",
+			job:      &CronJob{LastRun: hour(20), MisfirePolicy: MisfireSkip},
+			expected: []time.Time{},
+		},
+	} {
+		test.job.Schedule = "0 * * * *"
+		due, last, err := test.job.Due()
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expected, due, test.name)
+		assert.Equal(t, hour(23), last, test.name)
+	}
+}
+
+func TestCronJob_DueSkipOnTime(t *testing.T) {
+	job := &CronJob{
+		LastRun:       time.Date(2017, 05, 04, 23, 0, 0, 0, time.UTC),
+		Schedule:      "59 23 * * *",
+		MisfirePolicy: MisfireSkip,
+	}
+	due, _, err := job.Due()
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Time{time.Date(2017, 05, 04, 23, 59, 0, 0, time.UTC)}, due)
+
+	job.MisfirePolicy = "sometimes"
+	_, _, err = job.Due()
+	assert.EqualError(t, err, `unknown misfire policy "sometimes"`)
+}
+
+func TestScheduler_RunAll(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{
+		ctx: ctx,
+		ecs: mockEcs,
+		kv:  kv.NewLocalDB(),
+	}
+	sched.kv.Put(ctx, CronJobType, "job1", &CronJob{
+		LastRun:          time.Date(2017, 05, 04, 21, 30, 0, 0, time.UTC),
+		TaskDefinitionID: "testTask",
+		Cluster:          "testCluster",
+		Schedule:         "0 * * * *",
+		MisfirePolicy:    MisfireRunAll,
+	})
+	mockEcs.On("RunTask", mock.Anything).Return(nil, nil)
+
+	sched.evaluate()
+	sched.evaluate()
+
+	mockEcs.AssertNumberOfCalls(t, "RunTask", 2)
+	keys, _ := sched.kv.Keys(ctx, CronRunType)
+	assert.Equal(t, 2, len(keys))
+}
+
+func TestScheduler_NewJob(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{
+		ctx: ctx,
+		ecs: mockEcs,
+		kv:  kv.NewLocalDB(),
+	}
+	sched.kv.Put(ctx, CronJobType, "job1", &CronJob{Schedule: "0 * * * *"})
+
+	sched.evaluate()
+
+	mockEcs.AssertNotCalled(t, "RunTask", mock.Anything)
+	job := &CronJob{}
+	sched.kv.Get(ctx, CronJobType, "job1", job)
+	assert.Equal(t, GetTime(), job.LastRun)
+}
+
+func testConcurrencyJob(policy string) *CronJob {
+	return &CronJob{
+		LastRun:           time.Date(2017, 05, 04, 23, 30, 0, 0, time.UTC),
+		TaskDefinitionID:  "testTask",
+		Cluster:           "testCluster",
+		Schedule:          "45 * * * *",
+		ConcurrencyPolicy: policy,
+		Tasks:             []string{"old"},
+	}
+}
+
+func TestScheduler_ConcurrencyForbid(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{ctx: ctx, ecs: mockEcs, kv: kv.NewLocalDB()}
+	sched.kv.Put(ctx, CronJobType, "job1", testConcurrencyJob(ConcurrencyForbid))
+
+	mockEcs.On("DescribeTasks", "testCluster", []string{"old"}).Return([]*ecs.Task{
+		{TaskArn: aws.String("old"), LastStatus: aws.String("RUNNING")},
+	}, nil).Once()
+	sched.evaluate()
+	mockEcs.AssertNotCalled(t, "RunTask", mock.Anything)
+
+	// The run is skipped, not postponed.
+	job := &CronJob{}
+	sched.kv.Get(ctx, CronJobType, "job1", job)
+	assert.Equal(t, GetTime(), job.LastRun)
+	assert.Equal(t, []string{"old"}, job.Tasks)
+
+	run := &cronRun{}
+	sched.kv.Get(ctx, CronRunType, runKey("job1", time.Date(2017, 05, 04, 23, 45, 0, 0, time.UTC)), run)
+	assert.Equal(t, RunSkipped, run.Status)
+}
+
+func TestScheduler_ConcurrencyForbidStopped(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{ctx: ctx, ecs: mockEcs, kv: kv.NewLocalDB()}
+	sched.kv.Put(ctx, CronJobType, "job1", testConcurrencyJob(ConcurrencyForbid))
+
+	mockEcs.On("DescribeTasks", "testCluster", []string{"old"}).Return([]*ecs.Task{
+		{TaskArn: aws.String("old"), LastStatus: aws.String("STOPPED")},
+	}, nil).Once()
+	mockEcs.On("RunTask", mock.Anything).Return([]string{"new"}, nil).Once()
+	sched.evaluate()
+
+	job := &CronJob{}
+	sched.kv.Get(ctx, CronJobType, "job1", job)
+	assert.Equal(t, []string{"new"}, job.Tasks)
+	mockEcs.AssertExpectations(t)
+}
+
+func TestScheduler_ConcurrencyReplace(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{ctx: ctx, ecs: mockEcs, kv: kv.NewLocalDB()}
+	sched.kv.Put(ctx, CronJobType, "job1", testConcurrencyJob(ConcurrencyReplace))
+
+	mockEcs.On("DescribeTasks", "testCluster", []string{"old"}).Return([]*ecs.Task{
+		{TaskArn: aws.String("old"), LastStatus: aws.String("RUNNING")},
+	}, nil)
+	mockEcs.On("StopTask", "testCluster", "old").Return(nil)
+	mockEcs.On("RunTask", mock.Anything).Return([]string{"new"}, nil)
+
+	sched.evaluate()
+
+	mockEcs.AssertExpectations(t)
+	job := &CronJob{}
+	sched.kv.Get(ctx, CronJobType, "job1", job)
+	assert.Equal(t, []string{"new"}, job.Tasks)
+}
+
+func TestScheduler_ConcurrencyReplaceClaimed(t *testing.T) {
+	mockEcs := &MockECS{}
+	ctx := context.Background()
+	sched := &scheduler{ctx: ctx, ecs: mockEcs, kv: kv.NewLocalDB()}
+	sched.kv.Put(ctx, CronJobType, "job1", testConcurrencyJob(ConcurrencyReplace))
+
+	// Another scheduler already claimed the run.
+	scheduled := time.Date(2017, 05, 04, 23, 45, 0, 0, time.UTC)
+	sched.kv.Put(ctx, CronRunType, runKey("job1", scheduled), &cronRun{Job: "job1", Scheduled: scheduled})
+	mockEcs.On("DescribeTasks", "testCluster", []string{"old"}).Return([]*ecs.Task{
+		{TaskArn: aws.String("old"), LastStatus: aws.String("RUNNING")},
+	}, nil)
+
+	sched.evaluate()
+
+	mockEcs.AssertNotCalled(t, "StopTask", mock.Anything, mock.Anything)
+	mockEcs.AssertNotCalled(t, "RunTask", mock.Anything)
+	job := &CronJob{}
+	sched.kv.Get(ctx, CronJobType, "job1", job)
+	assert.Equal(t, []string{"old"}, job.Tasks)
+}
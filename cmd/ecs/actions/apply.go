@@ -1,124 +1,202 @@
 package actions
 
 import (
+	"bufio"
 	"context"
-	"github.com/ghodss/yaml"
 	"flag"
-	"github.com/aws/aws-sdk-go/aws"
+	"fmt"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/coldog/tool-ecs/internal/kv"
 	"github.com/pkg/errors"
 	"io"
 	"os"
+	"strings"
 	"time"
-	"encoding/json"
-	"io/ioutil"
 )
 
-type Spec struct {
-	Type    string          `json:"type"`
-	ID      string          `json:"id"`
-	Cluster string          `json:"cluster"`
-	Spec    json.RawMessage `json:"spec"`
-}
-
 type Apply struct {
-	flag   *flag.FlagSet
-	File   string
-	Region string
-	ecs    *ecs.ECS
+	Globals
+	File     string
+	Vars     stringList
+	VarFile  stringList
+	Prune    bool
+	Selector string
+	Set      string
+	DryRun   bool
+	Yes      bool
+	ecs      ECS
+	kv       kv.DB
+	stdin    io.Reader
 }
 
 func (cmd *Apply) ShortDescription() string { return "Apply a resource" }
-func (cmd *Apply) PrintUsage()              { cmd.flag.PrintDefaults() }
 
-func (cmd *Apply) ParseArgs(args []string) {
-	cmd.flag = flag.NewFlagSet("Apply", flag.ExitOnError)
-	cmd.flag.StringVar(&cmd.Region, "region", "us-west-2", "AWS Region")
-	cmd.flag.StringVar(&cmd.File, "f", "", "File to apply")
-	cmd.flag.Parse(args)
+func (cmd *Apply) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.File, "f", "", "File or directory to apply")
+	fs.Var(&cmd.Vars, "var", "Set a template variable as <name>=<value>, may be repeated")
+	fs.Var(&cmd.VarFile, "var-file", "Yaml file of template variables, may be repeated")
+	fs.BoolVar(&cmd.Prune, "prune", false, "Delete resources matching -selector that are not in the files")
+	fs.StringVar(&cmd.Selector, "selector", "", "Only apply resources with these labels, as <label>=<value>[,...]")
+	fs.StringVar(&cmd.Set, "set", "", "Manifest set the resources are applied as, -prune only deletes resources of the same set")
+	fs.BoolVar(&cmd.DryRun, "dry-run", false, "List the resources that would be applied and pruned")
+	fs.BoolVar(&cmd.Yes, "yes", false, "Prune without asking for confirmation")
 }
 
 func (cmd *Apply) Run(w io.Writer) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	f, err := os.OpenFile(cmd.File, os.O_RDONLY, 0600)
+	vars, err := loadVars(cmd.VarFile, cmd.Vars)
 	if err != nil {
-		return errors.Wrap(err, "Could not open file")
+		return err
 	}
-
-	sess, err := getSession(cmd.Region)
+	specs, err := readSpecs(cmd.File, vars)
 	if err != nil {
-		return errors.Wrap(err, "Could not open aws session")
+		return err
+	}
+	err = validateSpecs(w, specs)
+	if err != nil {
+		return err
 	}
 
-	spec := &Spec{}
-	data, err := ioutil.ReadAll(f)
+	selector, err := parseSelector(cmd.Selector)
 	if err != nil {
-		return errors.Wrap(err, "Could not read file")
+		return &UsageError{Message: err.Error()}
+	}
+	if cmd.Prune && len(selector) == 0 {
+		return &UsageError{Message: "Prune requires a -selector"}
 	}
-	err = yaml.Unmarshal(data, spec)
+	// Every spec read is kept from prune, only the selected ones are applied.
+	all := specs
+	specs = selectSpecs(specs, selector)
+
+	sess, err := getSession(cmd.Globals)
 	if err != nil {
-		return errors.Wrap(err, "Could not decode file")
+		return errors.Wrap(err, "Could not open aws session")
 	}
 
-	ecsClient := ecs.New(sess)
-	kvClient, err := kv.NewDynamoDB(sess)
+	cmd.ecs = ecs.New(sess)
+	cmd.kv, err = kv.NewDynamoDB(sess)
 	if err != nil {
 		return errors.Wrap(err, "Could not open dynamodb session")
 	}
 
-	cmd.ecs = ecsClient
+	if cmd.DryRun {
+		return cmd.dryRun(w, selector, specs, all)
+	}
 
-	switch spec.Type {
-	// Dynamo resources:
-	case "CronJob":
-		return kvClient.Put(ctx, spec.Type, spec.ID, spec.Spec)
+	failed := 0
+	results := make([]error, len(specs))
+	for i, spec := range specs {
+		results[i] = cmd.apply(spec)
+		if results[i] != nil {
+			failed++
+		}
+	}
+
+	io.WriteString(w, "Results:\n")
+	for i, spec := range specs {
+		if results[i] != nil {
+			io.WriteString(w, fmt.Sprintf("  %s (%s): failed -- %v\n", spec, spec.File, results[i]))
+		} else {
+			io.WriteString(w, fmt.Sprintf("  %s (%s): applied\n", spec, spec.File))
+		}
+	}
 
-	// ECS Resources:
-	case "TaskDefinition":
-		return cmd.handleTaskDefinition(ctx, spec)
-	case "Service":
-		return cmd.handleService(ctx, spec)
-	default:
-		return errors.Errorf("Could not recognize type %s", spec.Type)
+	if failed > 0 {
+		return errors.Errorf("Failed to apply %d of %d resources", failed, len(specs))
 	}
+	if cmd.Prune {
+		return cmd.prune(w, selector, all)
+	}
+	return nil
 }
 
-func (cmd *Apply) handleTaskDefinition(ctx context.Context, spec *Spec) error {
-	input := &ecs.RegisterTaskDefinitionInput{}
-	err := json.Unmarshal(spec.Spec, input)
+func (cmd *Apply) apply(spec *Spec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	c := &resourceClients{ecs: cmd.ecs, kv: cmd.kv}
+	r, err := newResource(spec.Type, c)
+	if err != nil {
+		return err
+	}
+	err = r.Apply(ctx, spec)
 	if err != nil {
 		return err
 	}
-	_, err = cmd.ecs.RegisterTaskDefinitionWithContext(ctx, input)
-	return err
+	err = tagManaged(ctx, c, cmd.Set, spec)
+	if err != nil {
+		return err
+	}
+	return markManaged(ctx, cmd.kv, cmd.Set, spec)
 }
 
-func (cmd *Apply) handleService(ctx context.Context, spec *Spec) error {
-	out, err := cmd.ecs.DescribeServices(&ecs.DescribeServicesInput{
-		Services: []*string{aws.String(spec.ID)},
-		Cluster:  aws.String(spec.Cluster),
-	})
+func (cmd *Apply) dryRun(w io.Writer, selector map[string]string, specs, all []*Spec) error {
+	io.WriteString(w, "Would apply:\n")
+	for _, spec := range specs {
+		io.WriteString(w, fmt.Sprintf("  %s (%s)\n", spec, spec.File))
+	}
+	if !cmd.Prune {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	candidates, err := pruneCandidates(ctx, cmd.kv, cmd.Set, selector, all)
 	if err != nil {
 		return err
 	}
-	if len(out.Services) == 0 {
-		input := &ecs.CreateServiceInput{}
-		err = json.Unmarshal(spec.Spec, input)
-		if err != nil {
-			return err
-		}
-		_, err = cmd.ecs.CreateServiceWithContext(ctx, input)
+	io.WriteString(w, "Would prune:\n")
+	for _, m := range candidates {
+		io.WriteString(w, fmt.Sprintf("  %s\n", m))
+	}
+	return nil
+}
 
-	} else {
-		input := &ecs.UpdateServiceInput{}
-		err = json.Unmarshal(spec.Spec, input)
+func (cmd *Apply) prune(w io.Writer, selector map[string]string, specs []*Spec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	candidates, err := pruneCandidates(ctx, cmd.kv, cmd.Set, selector, specs)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	io.WriteString(w, "Prune:\n")
+	for _, m := range candidates {
+		io.WriteString(w, fmt.Sprintf("  %s\n", m))
+	}
+	if !cmd.Yes && !cmd.confirm(w, fmt.Sprintf("Delete %d resources? [y/N] ", len(candidates))) {
+		io.WriteString(w, "Skipped prune\n")
+		return nil
+	}
+
+	c := &resourceClients{ecs: cmd.ecs, kv: cmd.kv}
+	failed := 0
+	for _, m := range candidates {
+		err := pruneResource(ctx, c, m)
 		if err != nil {
-			return err
+			io.WriteString(w, fmt.Sprintf("  %s: failed -- %v\n", m, err))
+			failed++
+		} else {
+			io.WriteString(w, fmt.Sprintf("  %s: deleted\n", m))
 		}
-		_, err = cmd.ecs.UpdateServiceWithContext(ctx, input)
 	}
-	return err
+	if failed > 0 {
+		return errors.Errorf("Failed to prune %d of %d resources", failed, len(candidates))
+	}
+	return nil
+}
+
+func (cmd *Apply) confirm(w io.Writer, prompt string) bool {
+	in := cmd.stdin
+	if in == nil {
+		in = os.Stdin
+	}
+	io.WriteString(w, prompt)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
@@ -0,0 +1,191 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+// ELB is the part of the ELBv2 API used to switch listener rules.
+type ELB interface {
+	DescribeTargetGroupsWithContext(ctx aws.Context, input *elbv2.DescribeTargetGroupsInput, opts ...request.Option) (*elbv2.DescribeTargetGroupsOutput, error)
+	DescribeListenersWithContext(ctx aws.Context, input *elbv2.DescribeListenersInput, opts ...request.Option) (*elbv2.DescribeListenersOutput, error)
+	DescribeRulesWithContext(ctx aws.Context, input *elbv2.DescribeRulesInput, opts ...request.Option) (*elbv2.DescribeRulesOutput, error)
+	ModifyListenerWithContext(ctx aws.Context, input *elbv2.ModifyListenerInput, opts ...request.Option) (*elbv2.ModifyListenerOutput, error)
+	ModifyRuleWithContext(ctx aws.Context, input *elbv2.ModifyRuleInput, opts ...request.Option) (*elbv2.ModifyRuleOutput, error)
+}
+
+// bluegreen runs the new task definition as a parallel <service>-green service
+// registered with the idle target group. Once it is stable the listener rules
+// are switched to it and it is baked, a failure switches traffic straight
+// back. The main service is then updated while the green service takes the
+// traffic, traffic is switched back and the green service is removed, so the
+// service keeps its name and target group across deploys.
+func (cmd *Deploy) bluegreen(w io.Writer, svc *ecs.Service, taskDefId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if len(svc.LoadBalancers) != 1 {
+		return errors.Errorf("Service %s must have exactly one load balancer for a bluegreen deploy", cmd.Service)
+	}
+	blue := aws.StringValue(svc.LoadBalancers[0].TargetGroupArn)
+	green := cmd.GreenTargetGroup
+	if blue == green {
+		return errors.Errorf("Service %s is already registered with %s", cmd.Service, green)
+	}
+
+	name := cmd.Service + "-green"
+	count := aws.Int64Value(svc.DesiredCount)
+	if flagIsSet(cmd.flag, "count") {
+		count = cmd.Count
+	}
+	io.WriteString(w, fmt.Sprintf("Starting %s with %d tasks of %s\n", name, count, taskDefId))
+
+	lb := *svc.LoadBalancers[0]
+	lb.TargetGroupArn = aws.String(green)
+	input := cmd.serviceCopy(svc, name, taskDefId, count)
+	input.LoadBalancers = []*ecs.LoadBalancer{&lb}
+	_, err := cmd.ecs.CreateServiceWithContext(ctx, input)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create green service")
+	}
+
+	r := &rollout{
+		ecs:            cmd.ecs,
+		w:              w,
+		cluster:        cmd.Cluster,
+		service:        name,
+		taskDefinition: taskDefId,
+		maxFailures:    cmd.MaxFailures,
+	}
+	err = r.wait(cmd.Timeout)
+	if err != nil {
+		cmd.removeService(w, name)
+		return errors.Wrap(err, "Green service failed, aborting deploy")
+	}
+
+	err = cmd.switchTraffic(w, blue, green)
+	if err == nil {
+		err = r.bake(cmd.BakeTime)
+	}
+	if err == nil {
+		io.WriteString(w, fmt.Sprintf("%s is healthy, updating %s\n", name, cmd.Service))
+		cmd.Wait = true
+		err = cmd.rolling(w, svc, taskDefId)
+	}
+
+	// The main service runs either the new or the previous task definition
+	// now, traffic is moved back before the green service is removed.
+	serr := cmd.switchTraffic(w, green, blue)
+	if serr != nil {
+		return errors.Wrapf(serr, "Could not switch traffic back to %s, %s is left running", cmd.Service, name)
+	}
+	cmd.removeService(w, name)
+	if err != nil {
+		return errors.Wrap(err, "Blue/green deploy failed")
+	}
+	return nil
+}
+
+// switchTraffic points every listener rule forwarding to one target group at
+// another, on all load balancers the target group is attached to.
+func (cmd *Deploy) switchTraffic(w io.Writer, from, to string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	groups, err := cmd.elb.DescribeTargetGroupsWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: []*string{aws.String(from)},
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not describe target groups")
+	}
+	if len(groups.TargetGroups) == 0 {
+		return errors.Errorf("Target group %s not found", from)
+	}
+
+	switched := 0
+	for _, lb := range groups.TargetGroups[0].LoadBalancerArns {
+		listeners := &elbv2.DescribeListenersInput{LoadBalancerArn: lb}
+		for {
+			out, err := cmd.elb.DescribeListenersWithContext(ctx, listeners)
+			if err != nil {
+				return errors.Wrap(err, "Could not describe listeners")
+			}
+			for _, listener := range out.Listeners {
+				n, err := cmd.switchRules(ctx, listener, from, to)
+				if err != nil {
+					return err
+				}
+				switched += n
+			}
+			if aws.StringValue(out.NextMarker) == "" {
+				break
+			}
+			listeners.Marker = out.NextMarker
+		}
+	}
+	if switched == 0 {
+		return errors.Errorf("No listener rules forward to %s", from)
+	}
+	io.WriteString(w, fmt.Sprintf("Switched %d listener rules from %s to %s\n", switched, from, to))
+	return nil
+}
+
+func (cmd *Deploy) switchRules(ctx context.Context, listener *elbv2.Listener, from, to string) (int, error) {
+	switched := 0
+	input := &elbv2.DescribeRulesInput{ListenerArn: listener.ListenerArn}
+	for {
+		out, err := cmd.elb.DescribeRulesWithContext(ctx, input)
+		if err != nil {
+			return switched, errors.Wrap(err, "Could not describe listener rules")
+		}
+		for _, rule := range out.Rules {
+			actions, ok := forwardTo(rule.Actions, from, to)
+			if !ok {
+				continue
+			}
+			// The default rule can only be changed through the listener.
+			if aws.BoolValue(rule.IsDefault) {
+				_, err = cmd.elb.ModifyListenerWithContext(ctx, &elbv2.ModifyListenerInput{
+					ListenerArn:    listener.ListenerArn,
+					DefaultActions: actions,
+				})
+			} else {
+				_, err = cmd.elb.ModifyRuleWithContext(ctx, &elbv2.ModifyRuleInput{
+					RuleArn: rule.RuleArn,
+					Actions: actions,
+				})
+			}
+			if err != nil {
+				return switched, errors.Wrapf(err, "Could not modify rule %s", aws.StringValue(rule.RuleArn))
+			}
+			switched++
+		}
+		if aws.StringValue(out.NextMarker) == "" {
+			return switched, nil
+		}
+		input.Marker = out.NextMarker
+	}
+}
+
+// forwardTo returns a copy of the actions with forwards to one target group
+// pointed at another, false when no action forwards to it.
+func forwardTo(actions []*elbv2.Action, from, to string) ([]*elbv2.Action, bool) {
+	found := false
+	out := make([]*elbv2.Action, len(actions))
+	for i, action := range actions {
+		copied := *action
+		if aws.StringValue(action.Type) == elbv2.ActionTypeEnumForward && aws.StringValue(action.TargetGroupArn) == from {
+			copied.TargetGroupArn = aws.String(to)
+			found = true
+		}
+		out[i] = &copied
+	}
+	return out, found
+}
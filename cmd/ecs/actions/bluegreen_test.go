@@ -0,0 +1,162 @@
+package actions
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+type MockELB struct {
+	mock.Mock
+}
+
+func (m *MockELB) DescribeTargetGroupsWithContext(ctx aws.Context, input *elbv2.DescribeTargetGroupsInput, opts ...request.Option) (*elbv2.DescribeTargetGroupsOutput, error) {
+	args := m.Called(input)
+	out, _ := args.Get(0).(*elbv2.DescribeTargetGroupsOutput)
+	return out, args.Error(1)
+}
+
+func (m *MockELB) DescribeListenersWithContext(ctx aws.Context, input *elbv2.DescribeListenersInput, opts ...request.Option) (*elbv2.DescribeListenersOutput, error) {
+	args := m.Called(input)
+	out, _ := args.Get(0).(*elbv2.DescribeListenersOutput)
+	return out, args.Error(1)
+}
+
+func (m *MockELB) DescribeRulesWithContext(ctx aws.Context, input *elbv2.DescribeRulesInput, opts ...request.Option) (*elbv2.DescribeRulesOutput, error) {
+	args := m.Called(input)
+	out, _ := args.Get(0).(*elbv2.DescribeRulesOutput)
+	return out, args.Error(1)
+}
+
+func (m *MockELB) ModifyListenerWithContext(ctx aws.Context, input *elbv2.ModifyListenerInput, opts ...request.Option) (*elbv2.ModifyListenerOutput, error) {
+	args := m.Called(input)
+	return &elbv2.ModifyListenerOutput{}, args.Error(0)
+}
+
+func (m *MockELB) ModifyRuleWithContext(ctx aws.Context, input *elbv2.ModifyRuleInput, opts ...request.Option) (*elbv2.ModifyRuleOutput, error) {
+	args := m.Called(input)
+	return &elbv2.ModifyRuleOutput{}, args.Error(0)
+}
+
+func forward(targetGroup string) []*elbv2.Action {
+	return []*elbv2.Action{{Type: aws.String(elbv2.ActionTypeEnumForward), TargetGroupArn: aws.String(targetGroup)}}
+}
+
+// mockListener serves a listener whose default rule and api rule forward to
+// the target group, the other rule is never switched.
+func mockListener(m *MockELB, targetGroup string) {
+	m.On("DescribeTargetGroupsWithContext", &elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: []*string{aws.String(targetGroup)},
+	}).Return(&elbv2.DescribeTargetGroupsOutput{TargetGroups: []*elbv2.TargetGroup{{
+		TargetGroupArn:   aws.String(targetGroup),
+		LoadBalancerArns: []*string{aws.String("lb")},
+	}}}, nil).Once()
+	m.On("DescribeListenersWithContext", &elbv2.DescribeListenersInput{LoadBalancerArn: aws.String("lb")}).Return(
+		&elbv2.DescribeListenersOutput{Listeners: []*elbv2.Listener{{ListenerArn: aws.String("listener")}}}, nil).Once()
+	m.On("DescribeRulesWithContext", &elbv2.DescribeRulesInput{ListenerArn: aws.String("listener")}).Return(
+		&elbv2.DescribeRulesOutput{Rules: []*elbv2.Rule{
+			{RuleArn: aws.String("default"), IsDefault: aws.Bool(true), Actions: forward(targetGroup)},
+			{RuleArn: aws.String("api"), Actions: forward(targetGroup)},
+			{RuleArn: aws.String("other"), Actions: forward("other")},
+		}}, nil).Once()
+}
+
+func mockSwitch(m *MockELB, from, to string) {
+	mockListener(m, from)
+	m.On("ModifyListenerWithContext", &elbv2.ModifyListenerInput{
+		ListenerArn:    aws.String("listener"),
+		DefaultActions: forward(to),
+	}).Return(nil).Once()
+	m.On("ModifyRuleWithContext", &elbv2.ModifyRuleInput{
+		RuleArn: aws.String("api"),
+		Actions: forward(to),
+	}).Return(nil).Once()
+}
+
+func TestForwardTo(t *testing.T) {
+	actions := append(forward("blue"), &elbv2.Action{Type: aws.String(elbv2.ActionTypeEnumFixedResponse)})
+
+	out, ok := forwardTo(actions, "blue", "green")
+	assert.True(t, ok)
+	assert.Equal(t, "green", aws.StringValue(out[0].TargetGroupArn))
+	assert.Equal(t, actions[1], out[1])
+	assert.Equal(t, "blue", aws.StringValue(actions[0].TargetGroupArn))
+
+	_, ok = forwardTo(actions, "green", "blue")
+	assert.False(t, ok)
+}
+
+func TestDeploy_BlueGreen(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	elb := &MockELB{}
+	cmd := testDeploy(t, m, "-strategy", "bluegreen", "-green-target-group", "green")
+	cmd.elb = elb
+	svc := fargateService()
+
+	m.On("CreateServiceWithContext", mock.MatchedBy(func(input *ecs.CreateServiceInput) bool {
+		return aws.StringValue(input.ServiceName) == "web-green" &&
+			aws.Int64Value(input.DesiredCount) == 3 &&
+			aws.StringValue(input.LoadBalancers[0].TargetGroupArn) == "green" &&
+			aws.StringValue(input.LoadBalancers[0].ContainerName) == "web" &&
+			isServiceCopy(svc, input)
+	})).Return(nil).Once()
+	mockService(m, "web-green", testDeployment("PRIMARY", "web:2", 3, 3))
+	mockStoppedTasks(m, "web-green")
+	mockSwitch(elb, "blue", "green")
+
+	m.On("UpdateServiceWithContext", &ecs.UpdateServiceInput{
+		Cluster:        aws.String("default"),
+		Service:        aws.String("web"),
+		TaskDefinition: aws.String("web:2"),
+	}).Return(nil).Once()
+	mockService(m, "web", testDeployment("PRIMARY", "web:2", 3, 3))
+	mockSwitch(elb, "green", "blue")
+	mockRemoveService(m, "web-green")
+
+	w := &bytes.Buffer{}
+	assert.Nil(t, cmd.bluegreen(w, svc, "web:2"))
+	assert.Contains(t, w.String(), "Switched 2 listener rules from blue to green")
+	assert.Contains(t, w.String(), "Switched 2 listener rules from green to blue")
+	assert.Equal(t, "blue", aws.StringValue(svc.LoadBalancers[0].TargetGroupArn))
+	m.AssertExpectations(t)
+	elb.AssertExpectations(t)
+}
+
+func TestDeploy_BlueGreenBakeFailed(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	elb := &MockELB{}
+	cmd := testDeploy(t, m, "-strategy", "bluegreen", "-green-target-group", "green")
+	cmd.elb = elb
+	svc := &ecs.Service{
+		ServiceName:    aws.String("web"),
+		TaskDefinition: aws.String("web:1"),
+		DesiredCount:   aws.Int64(1),
+		LoadBalancers:  []*ecs.LoadBalancer{{TargetGroupArn: aws.String("blue")}},
+	}
+
+	m.On("CreateServiceWithContext", mock.Anything).Return(nil).Once()
+	mockService(m, "web-green", testDeployment("PRIMARY", "web:2", 1, 1))
+	mockStoppedTasks(m, "web-green").Once()
+	mockStoppedTasks(m, "web-green", stoppedTask("task/1", "web:2", "Health check failed"))
+	mockSwitch(elb, "blue", "green")
+	mockSwitch(elb, "green", "blue")
+	mockRemoveService(m, "web-green")
+
+	err := cmd.bluegreen(&bytes.Buffer{}, svc, "web:2")
+	assert.EqualError(t, err, "Blue/green deploy failed: Tasks of web-green stopped while baking:\n  task/1: Health check failed")
+
+	// Traffic is back on the main service, which was never updated.
+	m.AssertExpectations(t)
+	elb.AssertExpectations(t)
+	m.AssertNotCalled(t, "UpdateServiceWithContext", mock.MatchedBy(func(input *ecs.UpdateServiceInput) bool {
+		return aws.StringValue(input.Service) == "web"
+	}))
+}
@@ -0,0 +1,97 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+// canary runs the new task definition as a separate <service>-canary service
+// behind the same load balancers. Once the canary has been healthy for the
+// bake time the main service is updated and the canary is removed.
+func (cmd *Deploy) canary(w io.Writer, svc *ecs.Service, taskDefId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	name := cmd.Service + "-canary"
+	io.WriteString(w, fmt.Sprintf("Starting canary %s with %d tasks of %s\n", name, cmd.CanaryCount, taskDefId))
+
+	input := cmd.serviceCopy(svc, name, taskDefId, cmd.CanaryCount)
+	_, err := cmd.ecs.CreateServiceWithContext(ctx, input)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create canary service")
+	}
+	defer cmd.removeService(w, name)
+
+	r := &rollout{
+		ecs:            cmd.ecs,
+		w:              w,
+		cluster:        cmd.Cluster,
+		service:        name,
+		taskDefinition: taskDefId,
+		maxFailures:    cmd.MaxFailures,
+	}
+	err = r.wait(cmd.Timeout)
+	if err == nil {
+		err = r.bake(cmd.BakeTime)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Canary failed, aborting deploy")
+	}
+
+	io.WriteString(w, fmt.Sprintf("Canary %s is healthy, promoting %s\n", name, taskDefId))
+	cmd.Wait = true
+	return cmd.rolling(w, svc, taskDefId)
+}
+
+// serviceCopy builds the input that creates a service like svc running the
+// task definition, used for the canary and green services.
+func (cmd *Deploy) serviceCopy(svc *ecs.Service, name, taskDefId string, count int64) *ecs.CreateServiceInput {
+	input := &ecs.CreateServiceInput{
+		Cluster:                       aws.String(cmd.Cluster),
+		ServiceName:                   aws.String(name),
+		TaskDefinition:                aws.String(taskDefId),
+		DesiredCount:                  aws.Int64(count),
+		DeploymentConfiguration:       svc.DeploymentConfiguration,
+		HealthCheckGracePeriodSeconds: svc.HealthCheckGracePeriodSeconds,
+		LaunchType:                    svc.LaunchType,
+		LoadBalancers:                 svc.LoadBalancers,
+		NetworkConfiguration:          svc.NetworkConfiguration,
+		PlacementConstraints:          svc.PlacementConstraints,
+		PlacementStrategy:             svc.PlacementStrategy,
+		PlatformVersion:               svc.PlatformVersion,
+		ServiceRegistries:             svc.ServiceRegistries,
+	}
+	// A role can not be passed for awsvpc services, ECS uses its linked role.
+	if len(svc.LoadBalancers) > 0 && svc.NetworkConfiguration == nil {
+		input.Role = svc.RoleArn
+	}
+	return input
+}
+
+// removeService drains and deletes a canary or green service.
+func (cmd *Deploy) removeService(w io.Writer, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := cmd.ecs.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
+		Cluster:      aws.String(cmd.Cluster),
+		Service:      aws.String(name),
+		DesiredCount: aws.Int64(0),
+	})
+	if err == nil {
+		_, err = cmd.ecs.DeleteServiceWithContext(ctx, &ecs.DeleteServiceInput{
+			Cluster: aws.String(cmd.Cluster),
+			Service: aws.String(name),
+		})
+	}
+	if err != nil {
+		io.WriteString(w, fmt.Sprintf("Failed to remove %s -- %v\n", name, err))
+		return
+	}
+	io.WriteString(w, fmt.Sprintf("Removed %s\n", name))
+}
@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func testDeploy(t *testing.T, m *MockECS, args ...string) *Deploy {
+	cmd := &Deploy{}
+	args = append([]string{"-service", "web", "-cluster", "default", "-timeout", "1s", "-bake-time", "20ms"}, args...)
+	assert.Nil(t, ParseArgs(NewFlagSet("deploy", cmd), cmd, append(args, "web=web:2")))
+	cmd.ecs = m
+	return cmd
+}
+
+// mockRemoveService expects the service to be drained and deleted.
+func mockRemoveService(m *MockECS, service string) {
+	m.On("UpdateServiceWithContext", &ecs.UpdateServiceInput{
+		Cluster:      aws.String("default"),
+		Service:      aws.String(service),
+		DesiredCount: aws.Int64(0),
+	}).Return(nil).Once()
+	m.On("DeleteServiceWithContext", &ecs.DeleteServiceInput{
+		Cluster: aws.String("default"),
+		Service: aws.String(service),
+	}).Return(nil).Once()
+}
+
+// fargateService is a Fargate service on awsvpc networking registered with a
+// load balancer and service discovery.
+func fargateService() *ecs.Service {
+	return &ecs.Service{
+		ServiceName:                   aws.String("web"),
+		TaskDefinition:                aws.String("web:1"),
+		DesiredCount:                  aws.Int64(3),
+		LaunchType:                    aws.String(ecs.LaunchTypeFargate),
+		PlatformVersion:               aws.String("1.3.0"),
+		HealthCheckGracePeriodSeconds: aws.Int64(30),
+		RoleArn:                       aws.String("arn:aws:iam::123:role/aws-service-role/ecs.amazonaws.com/AWSServiceRoleForECS"),
+		NetworkConfiguration: &ecs.NetworkConfiguration{AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+			Subnets:        aws.StringSlice([]string{"subnet-1"}),
+			SecurityGroups: aws.StringSlice([]string{"sg-1"}),
+		}},
+		ServiceRegistries: []*ecs.ServiceRegistry{{RegistryArn: aws.String("registry")}},
+		LoadBalancers: []*ecs.LoadBalancer{{
+			TargetGroupArn: aws.String("blue"),
+			ContainerName:  aws.String("web"),
+			ContainerPort:  aws.Int64(8080),
+		}},
+	}
+}
+
+// isServiceCopy checks the input creates a service configured like svc.
+func isServiceCopy(svc *ecs.Service, input *ecs.CreateServiceInput) bool {
+	return input.Role == nil &&
+		input.NetworkConfiguration == svc.NetworkConfiguration &&
+		aws.StringValue(input.LaunchType) == aws.StringValue(svc.LaunchType) &&
+		aws.StringValue(input.PlatformVersion) == aws.StringValue(svc.PlatformVersion) &&
+		aws.Int64Value(input.HealthCheckGracePeriodSeconds) == aws.Int64Value(svc.HealthCheckGracePeriodSeconds) &&
+		len(input.ServiceRegistries) == 1 && input.ServiceRegistries[0] == svc.ServiceRegistries[0]
+}
+
+func TestDeploy_ServiceCopyRole(t *testing.T) {
+	cmd := testDeploy(t, &MockECS{})
+	svc := &ecs.Service{
+		RoleArn:       aws.String("role"),
+		LoadBalancers: []*ecs.LoadBalancer{{TargetGroupArn: aws.String("blue")}},
+	}
+	assert.Equal(t, "role", aws.StringValue(cmd.serviceCopy(svc, "web-canary", "web:2", 1).Role))
+
+	svc = fargateService()
+	input := cmd.serviceCopy(svc, "web-canary", "web:2", 1)
+	assert.True(t, isServiceCopy(svc, input))
+}
+
+func TestDeploy_Canary(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	cmd := testDeploy(t, m, "-strategy", "canary", "-canary-count", "2")
+	svc := fargateService()
+
+	m.On("CreateServiceWithContext", mock.MatchedBy(func(input *ecs.CreateServiceInput) bool {
+		return aws.StringValue(input.ServiceName) == "web-canary" &&
+			aws.StringValue(input.TaskDefinition) == "web:2" &&
+			aws.Int64Value(input.DesiredCount) == 2 &&
+			aws.StringValue(input.LoadBalancers[0].TargetGroupArn) == "blue" &&
+			isServiceCopy(svc, input)
+	})).Return(nil).Once()
+	mockService(m, "web-canary", testDeployment("PRIMARY", "web:2", 2, 2))
+	mockStoppedTasks(m, "web-canary")
+
+	m.On("UpdateServiceWithContext", &ecs.UpdateServiceInput{
+		Cluster:        aws.String("default"),
+		Service:        aws.String("web"),
+		TaskDefinition: aws.String("web:2"),
+	}).Return(nil).Once()
+	mockService(m, "web", testDeployment("PRIMARY", "web:2", 4, 4))
+	mockRemoveService(m, "web-canary")
+
+	w := &bytes.Buffer{}
+	assert.Nil(t, cmd.canary(w, svc, "web:2"))
+	assert.Contains(t, w.String(), "Canary web-canary is healthy, promoting web:2")
+	assert.Contains(t, w.String(), "Removed web-canary")
+	m.AssertExpectations(t)
+}
+
+func TestDeploy_CanaryFailed(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	cmd := testDeploy(t, m, "-strategy", "canary", "-max-failures", "1")
+	svc := &ecs.Service{ServiceName: aws.String("web"), TaskDefinition: aws.String("web:1")}
+
+	m.On("CreateServiceWithContext", mock.Anything).Return(nil).Once()
+	mockService(m, "web-canary", testDeployment("PRIMARY", "web:2", 1, 0))
+	mockStoppedTasks(m, "web-canary", stoppedTask("task/1", "web:2", "Essential container exited"))
+	mockRemoveService(m, "web-canary")
+
+	err := cmd.canary(&bytes.Buffer{}, svc, "web:2")
+	assert.EqualError(t, err, "Canary failed, aborting deploy: Rollout of web-canary failed, 1 tasks stopped:\n  task/1: Essential container exited")
+
+	// The main service is left untouched.
+	m.AssertExpectations(t)
+	m.AssertNotCalled(t, "DescribeServicesWithContext", &ecs.DescribeServicesInput{
+		Cluster:  aws.String("default"),
+		Services: []*string{aws.String("web")},
+	})
+}
@@ -0,0 +1,103 @@
+package actions
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+)
+
+// Command is an action of the ecs cli. The cli creates the flag set with the
+// global flags, the command adds its own and Run is called once the arguments
+// are parsed.
+type Command interface {
+	ShortDescription() string
+	Global() *Globals
+	Flags(fs *flag.FlagSet)
+	Run(w io.Writer) error
+}
+
+// ArgsCommand is a command that takes positional arguments.
+type ArgsCommand interface {
+	Command
+	ArgsUsage() string
+	SetArgs(args []string) error
+}
+
+// Globals are the flags accepted by every command, flags that are not passed
+// are read from the active context.
+type Globals struct {
+	Region    string
+	Profile   string
+	Cluster   string
+	Output    string
+	Context   string
+	roleArn   string
+	mfaSerial string
+}
+
+func (g *Globals) Global() *Globals { return g }
+
+// UsageError is returned when the arguments of a command are invalid.
+type UsageError struct {
+	Message string
+}
+
+func (err *UsageError) Error() string { return err.Message }
+
+// NewFlagSet creates the flag set of a command with the global and command
+// flags registered.
+func NewFlagSet(name string, cmd Command) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	g := cmd.Global()
+	fs.StringVar(&g.Region, "region", "us-west-2", "AWS Region")
+	fs.StringVar(&g.Profile, "profile", "", "AWS shared credentials profile")
+	fs.StringVar(&g.Cluster, "cluster", "default", "AWS ECS Cluster")
+	fs.StringVar(&g.Output, "output", "", "Output format: table, json or yaml")
+	fs.StringVar(&g.Output, "o", "", "Shorthand for -output")
+	fs.StringVar(&g.Context, "context", "", "Context from "+configPath+", defaults to $ECS_CONTEXT or the current context")
+	cmd.Flags(fs)
+	return fs
+}
+
+// ParseArgs parses the arguments of a command. Flags may come before or after
+// positional arguments, everything after -- is positional.
+func ParseArgs(fs *flag.FlagSet, cmd Command, args []string) error {
+	rest := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			rest = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+
+	positional := []string{}
+	for {
+		err := fs.Parse(args)
+		if err == flag.ErrHelp {
+			return err
+		}
+		if err != nil {
+			return &UsageError{err.Error()}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	positional = append(positional, rest...)
+
+	if c, ok := cmd.(ArgsCommand); ok {
+		err := c.SetArgs(positional)
+		if err != nil {
+			return &UsageError{err.Error()}
+		}
+	} else if len(positional) > 0 {
+		return &UsageError{"Unexpected arguments: " + positional[0]}
+	}
+	return cmd.Global().resolve(fs)
+}
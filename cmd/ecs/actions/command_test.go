@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the user's contexts out of the tests.
+	configPath = "testdata/missing.yml"
+	os.Unsetenv("ECS_CONTEXT")
+	os.Exit(m.Run())
+}
+
+func parseTestArgs(cmd Command, args ...string) error {
+	return ParseArgs(NewFlagSet("test", cmd), cmd, args)
+}
+
+func TestParseArgs_Interspersed(t *testing.T) {
+	cmd := &Get{}
+	assert.Nil(t, parseTestArgs(cmd, "services", "-cluster", "prod", "web", "-o", "json"))
+	assert.Equal(t, "services", cmd.Type)
+	assert.Equal(t, []string{"web"}, cmd.IDs)
+	assert.Equal(t, "prod", cmd.Cluster)
+	assert.Equal(t, "json", cmd.Output)
+	assert.Equal(t, "us-west-2", cmd.Region)
+}
+
+func TestParseArgs_DoubleDash(t *testing.T) {
+	cmd := &Exec{}
+	assert.Nil(t, parseTestArgs(cmd, "-service", "web", "--", "ls", "-la"))
+	assert.Equal(t, "web", cmd.Service)
+	assert.Equal(t, []string{"ls", "-la"}, cmd.Command)
+}
+
+func TestParseArgs_Errors(t *testing.T) {
+	err := parseTestArgs(&Scale{}, "web")
+	assert.IsType(t, &UsageError{}, err)
+	assert.EqualError(t, err, "Unexpected arguments: web")
+
+	err = parseTestArgs(&Scale{}, "-unknown")
+	assert.IsType(t, &UsageError{}, err)
+
+	err = parseTestArgs(&Describe{}, "services")
+	assert.EqualError(t, err, "Describe requires a type and at least one id")
+
+	assert.Equal(t, flag.ErrHelp, parseTestArgs(&Scale{}, "-h"))
+}
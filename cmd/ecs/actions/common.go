@@ -1,20 +1,60 @@
 package actions
 
 import (
+	"flag"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"strings"
 )
 
 var sessions = map[string]*session.Session{}
 
-func getSession(region string) (*session.Session, error) {
-	if sess, ok := sessions[region]; ok {
+// getSession opens a session for the region and profile, assuming the role of
+// the context when it has one. MFA codes are read from stdin.
+func getSession(g Globals) (*session.Session, error) {
+	key := strings.Join([]string{g.Profile, g.Region, g.roleArn}, "/")
+	if sess, ok := sessions[key]; ok {
 		return sess, nil
 	}
-	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(g.Region)},
+		Profile:           g.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
 	if err != nil {
 		return nil, err
 	}
-	sessions[region] = sess
+	if g.roleArn != "" {
+		creds := stscreds.NewCredentials(sess, g.roleArn, func(p *stscreds.AssumeRoleProvider) {
+			if g.mfaSerial != "" {
+				p.SerialNumber = aws.String(g.mfaSerial)
+				p.TokenProvider = stscreds.StdinTokenProvider
+			}
+		})
+		sess = sess.Copy(&aws.Config{Credentials: creds})
+	}
+	sessions[key] = sess
 	return sess, nil
 }
+
+// stringList is a flag that may be passed multiple times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// flagIsSet reports whether the flag was passed explicitly.
+func flagIsSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
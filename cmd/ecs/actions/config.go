@@ -0,0 +1,188 @@
+package actions
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// The config file holding the named contexts.
+var configPath = "~/.ecs-toolkit/config.yml"
+
+// Config is the cli configuration file.
+type Config struct {
+	CurrentContext string              `json:"currentContext,omitempty"`
+	Contexts       map[string]*Context `json:"contexts,omitempty"`
+}
+
+// Context holds the defaults for an account and cluster.
+type Context struct {
+	Region    string `json:"region,omitempty"`
+	Profile   string `json:"profile,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+	RoleArn   string `json:"roleArn,omitempty"`
+	MFASerial string `json:"mfaSerial,omitempty"`
+}
+
+func loadConfig() (*Config, error) {
+	file, err := homedir.Expand(configPath)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read config")
+	}
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not parse config %s", file)
+	}
+	return config, nil
+}
+
+func (config *Config) save() error {
+	file, err := homedir.Expand(configPath)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return errors.Wrap(err, "Could not create config directory")
+	}
+	return errors.Wrap(ioutil.WriteFile(file, data, 0600), "Could not write config")
+}
+
+// context returns the named context, the ECS_CONTEXT environment variable or
+// the current context when the name is empty.
+func (config *Config) context(name string) (string, *Context, error) {
+	if name == "" {
+		name = os.Getenv("ECS_CONTEXT")
+	}
+	if name == "" {
+		name = config.CurrentContext
+	}
+	if name == "" {
+		return "", &Context{}, nil
+	}
+	ctx, ok := config.Contexts[name]
+	if !ok {
+		return "", nil, errors.Errorf("Context %s not found in %s", name, configPath)
+	}
+	return name, ctx, nil
+}
+
+// resolve fills the global flags that were not passed from the active context.
+func (g *Globals) resolve(fs *flag.FlagSet) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	_, ctx, err := config.context(g.Context)
+	if err != nil {
+		return err
+	}
+
+	set := func(value *string, name, fromContext, fallback string) {
+		if flagIsSet(fs, name) {
+			return
+		}
+		*value = fallback
+		if fromContext != "" {
+			*value = fromContext
+		}
+	}
+	set(&g.Region, "region", ctx.Region, "us-west-2")
+	set(&g.Cluster, "cluster", ctx.Cluster, "default")
+	set(&g.Profile, "profile", ctx.Profile, "")
+	g.roleArn = ctx.RoleArn
+	g.mfaSerial = ctx.MFASerial
+	return nil
+}
+
+// ContextUse sets the current context.
+type ContextUse struct {
+	Globals
+	Name string
+}
+
+func (cmd *ContextUse) ShortDescription() string { return "Set the current context" }
+func (cmd *ContextUse) ArgsUsage() string        { return "<name>" }
+func (cmd *ContextUse) Flags(fs *flag.FlagSet)   {}
+
+func (cmd *ContextUse) SetArgs(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Context use requires a context name")
+	}
+	cmd.Name = args[0]
+	return nil
+}
+
+func (cmd *ContextUse) Run(w io.Writer) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Contexts[cmd.Name]; !ok {
+		return errors.Errorf("Context %s not found in %s", cmd.Name, configPath)
+	}
+	config.CurrentContext = cmd.Name
+	err = config.save()
+	if err != nil {
+		return err
+	}
+	io.WriteString(w, fmt.Sprintf("Switched to context %s\n", cmd.Name))
+	return nil
+}
+
+// ContextList prints the contexts, marking the active one.
+type ContextList struct {
+	Globals
+}
+
+func (cmd *ContextList) ShortDescription() string { return "List the contexts" }
+func (cmd *ContextList) Flags(fs *flag.FlagSet)   {}
+
+func (cmd *ContextList) Run(w io.Writer) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	active, _, err := config.context(cmd.Context)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CURRENT\tNAME\tREGION\tPROFILE\tCLUSTER\tROLE")
+	for _, name := range names {
+		ctx := config.Contexts[name]
+		current := ""
+		if name == active {
+			current = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", current, name, ctx.Region, ctx.Profile, ctx.Cluster, ctx.RoleArn)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,95 @@
+package actions
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, data string) func() {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	prev := configPath
+	configPath = filepath.Join(dir, "config.yml")
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte(data), 0600))
+	return func() {
+		configPath = prev
+		os.RemoveAll(dir)
+	}
+}
+
+const testConfig = `
+currentContext: staging
+contexts:
+  staging:
+    region: us-east-1
+    cluster: staging
+  prod:
+    region: eu-west-1
+    profile: prod
+    cluster: prod
+    roleArn: arn:aws:iam::123:role/deploy
+    mfaSerial: arn:aws:iam::123:mfa/me
+`
+
+func TestGlobals_Resolve(t *testing.T) {
+	defer writeTestConfig(t, testConfig)()
+	os.Unsetenv("ECS_CONTEXT")
+
+	cmd := &Scale{}
+	assert.Nil(t, parseTestArgs(cmd))
+	assert.Equal(t, "us-east-1", cmd.Region)
+	assert.Equal(t, "staging", cmd.Cluster)
+	assert.Equal(t, "", cmd.roleArn)
+
+	cmd = &Scale{}
+	assert.Nil(t, parseTestArgs(cmd, "-context", "prod", "-cluster", "other"))
+	assert.Equal(t, "eu-west-1", cmd.Region)
+	assert.Equal(t, "prod", cmd.Profile)
+	assert.Equal(t, "other", cmd.Cluster)
+	assert.Equal(t, "arn:aws:iam::123:role/deploy", cmd.roleArn)
+	assert.Equal(t, "arn:aws:iam::123:mfa/me", cmd.mfaSerial)
+
+	os.Setenv("ECS_CONTEXT", "prod")
+	defer os.Unsetenv("ECS_CONTEXT")
+	cmd = &Scale{}
+	assert.Nil(t, parseTestArgs(cmd))
+	assert.Equal(t, "prod", cmd.Cluster)
+
+	os.Setenv("ECS_CONTEXT", "missing")
+	assert.EqualError(t, parseTestArgs(&Scale{}), "Context missing not found in "+configPath)
+}
+
+func TestGlobals_ResolveDefaults(t *testing.T) {
+	defer writeTestConfig(t, "")()
+	os.Unsetenv("ECS_CONTEXT")
+
+	cmd := &Scale{}
+	assert.Nil(t, parseTestArgs(cmd))
+	assert.Equal(t, "us-west-2", cmd.Region)
+	assert.Equal(t, "default", cmd.Cluster)
+}
+
+func TestContextUse(t *testing.T) {
+	defer writeTestConfig(t, testConfig)()
+	os.Unsetenv("ECS_CONTEXT")
+
+	buf := &bytes.Buffer{}
+	use := &ContextUse{Name: "prod"}
+	assert.Nil(t, use.Run(buf))
+	assert.Equal(t, "Switched to context prod\n", buf.String())
+
+	config, err := loadConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "prod", config.CurrentContext)
+	assert.Equal(t, "eu-west-1", config.Contexts["prod"].Region)
+
+	assert.EqualError(t, (&ContextUse{Name: "missing"}).Run(buf), "Context missing not found in "+configPath)
+
+	buf.Reset()
+	assert.Nil(t, (&ContextList{}).Run(buf))
+	assert.Regexp(t, `\*\s+prod\s+eu-west-1`, buf.String())
+}
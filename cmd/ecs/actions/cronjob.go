@@ -0,0 +1,67 @@
+package actions
+
+import (
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"strings"
+	"time"
+)
+
+// cronJob mirrors the CronJob the cron scheduler reads from the kv store, see
+// cmd/cronscheduler/scheduler.go.
+type cronJob struct {
+	LastRun          time.Time
+	TaskDefinitionID string
+	Cluster          string
+	Replicas         int
+	Overrides        []*ecs.ContainerOverride
+	Schedule         string
+
+	MisfirePolicy           string
+	MisfireLimit            int
+	StartingDeadlineSeconds int
+	ConcurrencyPolicy       string
+	Tasks                   []string
+
+	// Set by apply to mark the job as managed, see prune.go.
+	ManagedBy   string
+	ManifestSet string
+}
+
+// cronRun mirrors the run history the cron scheduler keeps, see
+// cmd/cronscheduler/history.go.
+type cronRun struct {
+	Job       string
+	Cluster   string
+	Scheduled time.Time
+	Claimed   time.Time
+	Stopped   time.Time
+	Tasks     []string
+	Status    string
+	Reason    string
+	Exits     []cronRunExit
+}
+
+// runJobKey returns the job of a run key, see cmd/cronscheduler/history.go.
+func runJobKey(run string) (string, bool) {
+	i := strings.LastIndex(run, "/")
+	if i < 0 {
+		return "", false
+	}
+	if _, err := time.Parse(time.RFC3339, run[i+1:]); err != nil {
+		return "", false
+	}
+	return run[:i], true
+}
+
+type cronRunExit struct {
+	Task      string
+	Container string
+	ExitCode  *int64
+	Reason    string
+}
+
+// The misfire policies the scheduler accepts.
+var misfirePolicies = map[string]bool{"skip": true, "runOnce": true, "runAll": true}
+
+// The concurrency policies the scheduler accepts.
+var concurrencyPolicies = map[string]bool{"Allow": true, "Forbid": true, "Replace": true}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/pkg/errors"
 	"io"
 	"strings"
@@ -13,39 +14,79 @@ import (
 )
 
 type Deploy struct {
-	flag       *flag.FlagSet
-	Region     string
-	Cluster    string
-	Service    string
-	Count      int64
-	Containers []string
-	ecs        *ecs.ECS
+	Globals
+	flag        *flag.FlagSet
+	Service     string
+	Count       int64
+	MinHealthy  int64
+	MaxPercent  int64
+	Wait        bool
+	Timeout     time.Duration
+	Rollback    bool
+	MaxFailures int
+	Strategy    string
+	CanaryCount int64
+	BakeTime    time.Duration
+	Containers  []string
+	Patch       containerPatch
+	// The idle target group the green service is registered with.
+	GreenTargetGroup string
+	ecs              ECS
+	elb              ELB
 }
 
-func (cmd *Deploy) ShortDescription() string { return "Scale a service" }
-func (cmd *Deploy) PrintUsage()              { cmd.flag.PrintDefaults() }
-
-func (cmd *Deploy) ParseArgs(args []string) {
-	cmd.flag = flag.NewFlagSet("Apply", flag.ExitOnError)
-	cmd.flag.StringVar(&cmd.Region, "region", "us-west-2", "AWS Region")
-	cmd.flag.StringVar(&cmd.Cluster, "cluster", "default", "AWS ECS Cluster")
-	cmd.flag.Int64Var(&cmd.Count, "count", 1, "Desired count")
-	cmd.flag.StringVar(&cmd.Service, "service", "", "Service name")
-	cmd.flag.Parse(args)
-	cmd.Containers = cmd.flag.Args()
+func (cmd *Deploy) ShortDescription() string { return "Deploy new images to a service" }
+func (cmd *Deploy) ArgsUsage() string        { return "<container>=<image>..." }
+
+func (cmd *Deploy) Flags(fs *flag.FlagSet) {
+	cmd.flag = fs
+	fs.Int64Var(&cmd.Count, "count", 0, "Desired count, defaults to the current desired count")
+	fs.Int64Var(&cmd.MinHealthy, "min-healthy-percent", 0, "Minimum healthy percent for this rollout")
+	fs.Int64Var(&cmd.MaxPercent, "max-percent", 0, "Maximum percent for this rollout")
+	fs.StringVar(&cmd.Service, "service", "", "Service name")
+	fs.BoolVar(&cmd.Wait, "wait", false, "Wait for the rollout to complete")
+	fs.DurationVar(&cmd.Timeout, "timeout", 10*time.Minute, "How long to wait for the rollout")
+	fs.BoolVar(&cmd.Rollback, "rollback", true, "Roll back to the previous task definition if the rollout fails, requires -wait")
+	fs.IntVar(&cmd.MaxFailures, "max-failures", 3, "Fail the rollout once this many new tasks have stopped, 0 waits for the timeout")
+	fs.StringVar(&cmd.Strategy, "strategy", "rolling", "Deployment strategy, rolling, canary or bluegreen")
+	fs.Int64Var(&cmd.CanaryCount, "canary-count", 1, "Number of canary tasks to run")
+	fs.DurationVar(&cmd.BakeTime, "bake-time", 5*time.Minute, "How long the canary or green service must stay healthy before it is promoted")
+	fs.StringVar(&cmd.GreenTargetGroup, "green-target-group", "", "ARN of the idle target group the green service is registered with, required for bluegreen")
+	fs.Var(&cmd.Patch.Env, "env", "Set an environment variable as <container>:KEY=VAL, may be repeated")
+	fs.Var(&cmd.Patch.UnsetEnv, "unset-env", "Remove an environment variable as <container>:KEY, may be repeated")
+	fs.Var(&cmd.Patch.Cpu, "cpu", "Set cpu units as <container>:units")
+	fs.Var(&cmd.Patch.Memory, "memory", "Set the memory limit as <container>:MiB")
+	fs.Var(&cmd.Patch.Command, "command", `Set the command as <container>:["command", "args"]`)
+	fs.Var(&cmd.Patch.Secret, "secret", "Set a secret from the parameter store as <container>:KEY=ARN, may be repeated")
+}
+
+func (cmd *Deploy) SetArgs(args []string) error {
+	cmd.Containers = args
+	return nil
 }
 
 func (cmd *Deploy) Run(w io.Writer) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if cmd.Strategy != "rolling" && cmd.Strategy != "canary" && cmd.Strategy != "bluegreen" {
+		return errors.Errorf("Unknown strategy %s, expected rolling, canary or bluegreen", cmd.Strategy)
+	}
+	if cmd.Strategy == "bluegreen" && cmd.GreenTargetGroup == "" {
+		return errors.New("The bluegreen strategy requires -green-target-group")
+	}
 
-	sess, err := getSession(cmd.Region)
+	sess, err := getSession(cmd.Globals)
 	if err != nil {
 		return errors.Wrap(err, "Could not open aws session")
 	}
 	cmd.ecs = ecs.New(sess)
+	cmd.elb = elbv2.New(sess)
+	return cmd.deploy(w)
+}
+
+func (cmd *Deploy) deploy(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	svcs, err := cmd.ecs.DescribeServices(&ecs.DescribeServicesInput{
+	svcs, err := cmd.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
 		Cluster:  aws.String(cmd.Cluster),
 		Services: []*string{aws.String(cmd.Service)},
 	})
@@ -70,14 +111,15 @@ func (cmd *Deploy) Run(w io.Writer) error {
 	io.WriteString(w, fmt.Sprintf("Updating containers: %+v\n", containerUpdates))
 
 	// Get the current task definition
-	taskDefDesc, err := cmd.ecs.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+	taskDefDesc, err := cmd.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
 		TaskDefinition: svc.TaskDefinition,
+		Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
 	})
 	if err != nil {
 		return errors.Wrap(err, "Failed to describe task definition")
 	}
 
-	taskDef := taskDefDesc.TaskDefinition
+	taskDef := cloneTaskDefinition(taskDefDesc)
 
 	// Replace container images
 	for _, container := range taskDef.ContainerDefinitions {
@@ -86,29 +128,98 @@ func (cmd *Deploy) Run(w io.Writer) error {
 		}
 	}
 
+	err = cmd.Patch.apply(taskDef)
+	if err != nil {
+		return err
+	}
+
 	// Register a new task definition
-	taskDefUpdate, err := cmd.ecs.RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
-		ContainerDefinitions: taskDef.ContainerDefinitions,
-		Family:               taskDef.Family,
-		NetworkMode:          taskDef.NetworkMode,
-		PlacementConstraints: taskDef.PlacementConstraints,
-		TaskRoleArn:          taskDef.TaskRoleArn,
-		Volumes:              taskDef.Volumes,
-	})
+	taskDefUpdate, err := cmd.ecs.RegisterTaskDefinitionWithContext(ctx, taskDef)
 	if err != nil {
 		return errors.Wrap(err, "Failed to update task definition")
 	}
 
 	taskDefId := *taskDefUpdate.TaskDefinition.TaskDefinitionArn
 
-	io.WriteString(w, "Updating service with new task definition "+taskDefId)
+	switch cmd.Strategy {
+	case "canary":
+		return cmd.canary(w, svc, taskDefId)
+	case "bluegreen":
+		return cmd.bluegreen(w, svc, taskDefId)
+	}
+	return cmd.rolling(w, svc, taskDefId)
+}
+
+// rolling updates the service in place and rolls back when the rollout fails.
+func (cmd *Deploy) rolling(w io.Writer, svc *ecs.Service, taskDefId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	io.WriteString(w, "Updating service with new task definition "+taskDefId+"\n")
+
+	r := &rollout{
+		ecs:            cmd.ecs,
+		w:              w,
+		cluster:        cmd.Cluster,
+		service:        cmd.Service,
+		taskDefinition: taskDefId,
+		maxFailures:    cmd.MaxFailures,
+	}
+	r.skipEvents(svc)
 
 	// Update the service
-	_, err = cmd.ecs.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
+	_, err := cmd.ecs.UpdateServiceWithContext(ctx, cmd.updateInput(svc, taskDefId))
+	if err != nil || !cmd.Wait {
+		return err
+	}
+
+	err = r.wait(cmd.Timeout)
+	if err == nil || !cmd.Rollback {
+		return err
+	}
+
+	io.WriteString(w, fmt.Sprintf("Rollout failed -- %v\n", err))
+
+	rollbackCtx, rollbackCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer rollbackCancel()
+
+	previous := aws.StringValue(svc.TaskDefinition)
+	rerr := rollbackService(rollbackCtx, r, taskDefId, previous)
+	if rerr == nil {
+		rerr = r.wait(cmd.Timeout)
+	}
+	if rerr != nil {
+		return errors.Wrapf(rerr, "Rollback after failed rollout did not complete (%v)", err)
+	}
+	return errors.Errorf("Rollout of %s failed and was rolled back to %s", taskDefId, previous)
+}
+
+// updateInput keeps the current desired count and deployment configuration
+// unless they were overridden on the command line.
+func (cmd *Deploy) updateInput(svc *ecs.Service, taskDefId string) *ecs.UpdateServiceInput {
+	input := &ecs.UpdateServiceInput{
 		Cluster:        aws.String(cmd.Cluster),
 		Service:        aws.String(cmd.Service),
-		DesiredCount:   aws.Int64(cmd.Count),
 		TaskDefinition: aws.String(taskDefId),
-	})
-	return err
+	}
+	if flagIsSet(cmd.flag, "count") {
+		input.DesiredCount = aws.Int64(cmd.Count)
+	}
+
+	minHealthy := flagIsSet(cmd.flag, "min-healthy-percent")
+	maxPercent := flagIsSet(cmd.flag, "max-percent")
+	if minHealthy || maxPercent {
+		config := &ecs.DeploymentConfiguration{}
+		if svc.DeploymentConfiguration != nil {
+			*config = *svc.DeploymentConfiguration
+		}
+		if minHealthy {
+			config.MinimumHealthyPercent = aws.Int64(cmd.MinHealthy)
+		}
+		if maxPercent {
+			config.MaximumPercent = aws.Int64(cmd.MaxPercent)
+		}
+		input.DeploymentConfiguration = config
+	}
+	return input
 }
@@ -0,0 +1,70 @@
+package actions
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+var deploySvc = &ecs.Service{
+	DesiredCount: aws.Int64(20),
+	DeploymentConfiguration: &ecs.DeploymentConfiguration{
+		MinimumHealthyPercent: aws.Int64(50),
+		MaximumPercent:        aws.Int64(100),
+	},
+}
+
+func TestDeploy_KeepsDesiredCount(t *testing.T) {
+	cmd := &Deploy{}
+	assert.Nil(t, ParseArgs(NewFlagSet("deploy", cmd), cmd, []string{"-service", "web", "web=web:2"}))
+
+	input := cmd.updateInput(deploySvc, "web:2")
+	assert.Nil(t, input.DesiredCount)
+	assert.Nil(t, input.DeploymentConfiguration)
+}
+
+func TestDeploy_Overrides(t *testing.T) {
+	cmd := &Deploy{}
+	assert.Nil(t, ParseArgs(NewFlagSet("deploy", cmd), cmd, []string{"-service", "web", "-count", "3", "-max-percent", "200", "web=web:2"}))
+
+	input := cmd.updateInput(deploySvc, "web:2")
+	assert.Equal(t, int64(3), *input.DesiredCount)
+	assert.Equal(t, &ecs.DeploymentConfiguration{
+		MinimumHealthyPercent: aws.Int64(50),
+		MaximumPercent:        aws.Int64(200),
+	}, input.DeploymentConfiguration)
+	assert.Equal(t, int64(100), *deploySvc.DeploymentConfiguration.MaximumPercent)
+}
+
+func TestDeploy_KeepsTags(t *testing.T) {
+	m := &MockECS{}
+	cmd := testDeploy(t, m)
+	tags := []*ecs.Tag{{Key: aws.String("team"), Value: aws.String("platform")}}
+
+	m.On("DescribeServicesWithContext", mock.Anything).Return(&ecs.DescribeServicesOutput{Services: []*ecs.Service{{
+		ServiceName:    aws.String("web"),
+		TaskDefinition: aws.String("web:1"),
+	}}}, nil)
+	m.On("DescribeTaskDefinitionWithContext", &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String("web:1"),
+		Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
+	}).Return(&ecs.DescribeTaskDefinitionOutput{
+		TaskDefinition: &ecs.TaskDefinition{
+			Family:               aws.String("web"),
+			ContainerDefinitions: []*ecs.ContainerDefinition{{Name: aws.String("web"), Image: aws.String("web:1")}},
+		},
+		Tags: tags,
+	}, nil)
+	m.On("RegisterTaskDefinitionWithContext", &ecs.RegisterTaskDefinitionInput{
+		Family:               aws.String("web"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{Name: aws.String("web"), Image: aws.String("web:2")}},
+		Tags:                 tags,
+	}).Return(nil).Once()
+	m.On("UpdateServiceWithContext", mock.Anything).Return(nil).Once()
+
+	assert.Nil(t, cmd.deploy(&bytes.Buffer{}))
+	m.AssertExpectations(t)
+}
@@ -0,0 +1,292 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/pkg/errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// Diff compares the resources in a file or directory against their live state.
+type Diff struct {
+	Globals
+	File    string
+	Vars    stringList
+	VarFile stringList
+	NoColor bool
+	ecs     ECS
+	kv      kv.DB
+}
+
+func (cmd *Diff) ShortDescription() string { return "Show changes apply would make" }
+
+func (cmd *Diff) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.File, "f", "", "File or directory to diff")
+	fs.Var(&cmd.Vars, "var", "Set a template variable as <name>=<value>, may be repeated")
+	fs.Var(&cmd.VarFile, "var-file", "Yaml file of template variables, may be repeated")
+	fs.BoolVar(&cmd.NoColor, "no-color", false, "Disable colored output")
+}
+
+func (cmd *Diff) Run(w io.Writer) error {
+	vars, err := loadVars(cmd.VarFile, cmd.Vars)
+	if err != nil {
+		return err
+	}
+	specs, err := readSpecs(cmd.File, vars)
+	if err != nil {
+		return err
+	}
+
+	sess, err := getSession(cmd.Globals)
+	if err != nil {
+		return errors.Wrap(err, "Could not open aws session")
+	}
+
+	cmd.ecs = ecs.New(sess)
+	cmd.kv, err = kv.NewDynamoDB(sess)
+	if err != nil {
+		return errors.Wrap(err, "Could not open dynamodb session")
+	}
+
+	drifted := 0
+	for _, spec := range specs {
+		changes, err := cmd.diff(spec)
+		if err != nil {
+			return errors.Wrapf(err, "Could not diff %s", spec)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		drifted++
+		io.WriteString(w, fmt.Sprintf("~ %s (%s)\n", spec, spec.File))
+		for _, change := range changes {
+			io.WriteString(w, change.format(!cmd.NoColor))
+		}
+	}
+
+	if drifted > 0 {
+		return errors.Errorf("Drift detected in %d of %d resources", drifted, len(specs))
+	}
+	io.WriteString(w, "No changes\n")
+	return nil
+}
+
+func (cmd *Diff) diff(spec *Spec) ([]fieldDiff, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	r, err := newResource(spec.Type, &resourceClients{ecs: cmd.ecs, kv: cmd.kv})
+	if err != nil {
+		return nil, err
+	}
+	return r.Diff(ctx, spec)
+}
+
+// The messages of the ClientExceptions ECS returns for missing resources.
+var notFoundMessages = []string{"unable to describe task definition", "not found", "missing"}
+
+// isNotFound reports whether an ECS describe call failed because the resource
+// does not exist. ECS reports this as a ClientException, which is also used for
+// other problems such as invalid parameters, so the message is matched too.
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case "ServiceNotFoundException", "ClusterNotFoundException":
+		return true
+	case "ClientException":
+		msg := strings.ToLower(aerr.Message())
+		for _, m := range notFoundMessages {
+			if strings.Contains(msg, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// convert copies the json representation of one struct into another, fields
+// with matching names are carried over and all others are dropped.
+func convert(from interface{}, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
+
+type fieldDiff struct {
+	Path    string
+	Live    interface{}
+	Desired interface{}
+}
+
+func (d fieldDiff) format(color bool) string {
+	red, green, reset := colorRed, colorGreen, colorReset
+	if !color {
+		red, green, reset = "", "", ""
+	}
+	out := ""
+	if d.Live != nil {
+		out += fmt.Sprintf("    %s- %s: %s%s\n", red, d.Path, formatValue(d.Live), reset)
+	}
+	if d.Desired != nil {
+		out += fmt.Sprintf("    %s+ %s: %s%s\n", green, d.Path, formatValue(d.Desired), reset)
+	}
+	return out
+}
+
+func formatValue(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// diffSpec compares the live and desired states after normalizing both to
+// generic json values. Only fields set in the desired state are compared,
+// fields that are only set on the live resource are defaults filled in by AWS.
+func diffSpec(live, desired interface{}) ([]fieldDiff, error) {
+	l, err := normalize(live)
+	if err != nil {
+		return nil, err
+	}
+	d, err := normalize(desired)
+	if err != nil {
+		return nil, err
+	}
+	changes := []fieldDiff{}
+	diffValues("", l, d, &changes)
+	return changes, nil
+}
+
+// normalize converts a value to its json form and removes null and empty
+// values so that unset and empty fields compare as equal.
+func normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(data, &out)
+	if err != nil {
+		return nil, err
+	}
+	return prune(out), nil
+}
+
+func prune(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range val {
+			if item = prune(item); item != nil {
+				out[k] = item
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	case []interface{}:
+		out := []interface{}{}
+		for _, item := range val {
+			out = append(out, prune(item))
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func diffValues(path string, live, desired interface{}, changes *[]fieldDiff) {
+	if desired == nil {
+		return
+	}
+
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok && live != nil {
+			*changes = append(*changes, fieldDiff{path, live, desired})
+			return
+		}
+		keys := []string{}
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValues(joinPath(path, k), lookup(l, k), d[k], changes)
+		}
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			*changes = append(*changes, fieldDiff{path, live, desired})
+			return
+		}
+		for i := range d {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), l[i], d[i], changes)
+		}
+	case string:
+		if l, ok := live.(string); ok && arnMatches(l, d) {
+			return
+		}
+		*changes = append(*changes, fieldDiff{path, live, desired})
+	default:
+		if !reflect.DeepEqual(live, desired) {
+			*changes = append(*changes, fieldDiff{path, live, desired})
+		}
+	}
+}
+
+// lookup finds a key in a map, json keys are matched case insensitively the
+// same way encoding/json decodes them.
+func lookup(m map[string]interface{}, key string) interface{} {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+// arnMatches compares a live value against a desired value that may be the
+// short name of the resource the live ARN points to.
+func arnMatches(live, desired string) bool {
+	if live == desired {
+		return true
+	}
+	return strings.HasPrefix(live, "arn:") && strings.HasSuffix(live, "/"+desired)
+}
+
+func joinPath(path, key string) string {
+	if key != "" {
+		key = strings.ToLower(key[:1]) + key[1:]
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,71 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiffSpec_NoChanges(t *testing.T) {
+	live := &ecs.CreateServiceInput{
+		Cluster:        aws.String("arn:aws:ecs:us-west-2:123:cluster/default"),
+		ServiceName:    aws.String("web"),
+		DesiredCount:   aws.Int64(2),
+		TaskDefinition: aws.String("arn:aws:ecs:us-west-2:123:task-definition/web:3"),
+		LoadBalancers:  []*ecs.LoadBalancer{{ContainerName: aws.String("web")}},
+	}
+	desired := &ecs.CreateServiceInput{
+		Cluster:        aws.String("default"),
+		ServiceName:    aws.String("web"),
+		DesiredCount:   aws.Int64(2),
+		TaskDefinition: aws.String("arn:aws:ecs:us-west-2:123:task-definition/web:3"),
+	}
+	changes, err := diffSpec(live, desired)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(changes))
+}
+
+func TestDiffSpec_Changes(t *testing.T) {
+	live := &ecs.RegisterTaskDefinitionInput{
+		Family: aws.String("web"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("web"), Image: aws.String("web:1"), Essential: aws.Bool(true)},
+		},
+	}
+	desired := &ecs.RegisterTaskDefinitionInput{
+		Family: aws.String("web"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("web"), Image: aws.String("web:2"), Memory: aws.Int64(128)},
+		},
+	}
+	changes, err := diffSpec(live, desired)
+	assert.Nil(t, err)
+	assert.Equal(t, []fieldDiff{
+		{Path: "containerDefinitions[0].image", Live: "web:1", Desired: "web:2"},
+		{Path: "containerDefinitions[0].memory", Live: nil, Desired: float64(128)},
+	}, changes)
+}
+
+func TestDiffSpec_Missing(t *testing.T) {
+	changes, err := diffSpec(nil, json.RawMessage(`{"Schedule": "0 * * * *"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []fieldDiff{{Path: "schedule", Desired: "0 * * * *"}}, changes)
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(awserr.New("ClientException", "Unable to describe task definition.", nil)))
+	assert.True(t, isNotFound(awserr.New("ServiceNotFoundException", "Service not found.", nil)))
+	assert.False(t, isNotFound(awserr.New("ClientException", "Identifier is for 123. Your accountId is 456", nil)))
+	assert.False(t, isNotFound(awserr.New("AccessDeniedException", "not authorized", nil)))
+	assert.False(t, isNotFound(errors.New("Unable to describe task definition")))
+}
+
+func TestJoinPath(t *testing.T) {
+	assert.Equal(t, "spec.desiredCount", joinPath("spec", "DesiredCount"))
+	assert.Equal(t, "spec.", joinPath("spec", ""))
+	assert.Equal(t, "", joinPath("", ""))
+}
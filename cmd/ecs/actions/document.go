@@ -0,0 +1,68 @@
+package actions
+
+import (
+	"reflect"
+	"time"
+)
+
+// toDocument converts an SDK value to generic maps and slices keyed by the
+// API field names, such as containerDefinitions, the same names used in the
+// resource files. Unset fields are dropped.
+func toDocument(v interface{}) interface{} {
+	return documentValue(reflect.ValueOf(v))
+}
+
+func documentValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return documentValue(v.Elem())
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			if t.IsZero() {
+				return nil
+			}
+			return t.Format(time.RFC3339)
+		}
+		out := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Tag.Get("locationName")
+			if name == "" {
+				name = field.Name
+			}
+			if value := documentValue(v.Field(i)); value != nil {
+				out[name] = value
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		out := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			out = append(out, documentValue(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			out[key.String()] = documentValue(v.MapIndex(key))
+		}
+		return out
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,255 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The ECS agent introspection endpoint on the container instances.
+const agentTasksURL = "http://localhost:51678/v1/tasks"
+
+// EC2 is the part of the EC2 API used to reach container instances.
+type EC2 interface {
+	DescribeInstancesWithContext(ctx aws.Context, input *ec2.DescribeInstancesInput, opts ...request.Option) (*ec2.DescribeInstancesOutput, error)
+}
+
+// Exec opens a command in a container of a running task over ssh.
+type Exec struct {
+	Globals
+	Service   string
+	Task      string
+	Container string
+	Bastion   string
+	User      string
+	Key       string
+	Command   []string
+	host      bool
+	ecs       *ecs.ECS
+	ec2       EC2
+}
+
+func (cmd *Exec) ShortDescription() string { return "Run a command in a task's container" }
+func (cmd *Exec) ArgsUsage() string        { return "[command...]" }
+
+func (cmd *Exec) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.Service, "service", "", "Use a running task of this service")
+	fs.StringVar(&cmd.Task, "task", "", "Task ID")
+	fs.StringVar(&cmd.Container, "container", "", "Container name, defaults to the first container")
+	fs.StringVar(&cmd.Bastion, "bastion", "", "Bastion host to connect through")
+	fs.StringVar(&cmd.User, "user", "ec2-user", "SSH user")
+	fs.StringVar(&cmd.Key, "key", "", "SSH identity file")
+}
+
+func (cmd *Exec) SetArgs(args []string) error {
+	cmd.Command = args
+	return nil
+}
+
+func (cmd *Exec) Run(w io.Writer) error {
+	if cmd.Service == "" && cmd.Task == "" {
+		return errors.New("Exec requires a service or task")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sess, err := getSession(cmd.Globals)
+	if err != nil {
+		return errors.Wrap(err, "Could not open aws session")
+	}
+	cmd.ecs = ecs.New(sess)
+	cmd.ec2 = ec2.New(sess)
+
+	task, err := cmd.findTask(ctx)
+	if err != nil {
+		return err
+	}
+	host, err := cmd.findHost(ctx, task)
+	if err != nil {
+		return err
+	}
+
+	if cmd.host {
+		return cmd.ssh(host, true, cmd.Command...)
+	}
+
+	container, err := taskContainer(task, cmd.Container)
+	if err != nil {
+		return err
+	}
+	dockerID, err := cmd.dockerID(host, aws.StringValue(task.TaskArn), container)
+	if err != nil {
+		return err
+	}
+
+	command := cmd.Command
+	if len(command) == 0 {
+		command = []string{"sh"}
+	}
+	return cmd.ssh(host, true, append([]string{"docker", "exec", "-it", dockerID}, command...)...)
+}
+
+// findTask describes the task given or the first running task of the service.
+func (cmd *Exec) findTask(ctx context.Context) (*ecs.Task, error) {
+	taskID := cmd.Task
+	if taskID == "" {
+		out, err := cmd.ecs.ListTasksWithContext(ctx, &ecs.ListTasksInput{
+			Cluster:       aws.String(cmd.Cluster),
+			ServiceName:   aws.String(cmd.Service),
+			DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list tasks")
+		}
+		if len(out.TaskArns) == 0 {
+			return nil, errors.Errorf("Service %s has no running tasks", cmd.Service)
+		}
+		taskID = aws.StringValue(out.TaskArns[0])
+	}
+
+	out, err := cmd.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cmd.Cluster),
+		Tasks:   []*string{aws.String(taskID)},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not describe tasks")
+	}
+	if len(out.Tasks) == 0 {
+		return nil, errors.Errorf("Task %s not found", taskID)
+	}
+	return out.Tasks[0], nil
+}
+
+// findHost returns the private IP of the container instance running the task.
+func (cmd *Exec) findHost(ctx context.Context, task *ecs.Task) (string, error) {
+	if aws.StringValue(task.ContainerInstanceArn) == "" {
+		return "", errors.Errorf("Task %s has no container instance to connect to, Fargate tasks are not supported",
+			shortName(aws.StringValue(task.TaskArn)))
+	}
+
+	out, err := cmd.ecs.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+		Cluster:            aws.String(cmd.Cluster),
+		ContainerInstances: []*string{task.ContainerInstanceArn},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Could not describe container instances")
+	}
+	if len(out.ContainerInstances) == 0 {
+		return "", errors.Errorf("Container instance %s not found", aws.StringValue(task.ContainerInstanceArn))
+	}
+
+	instances, err := cmd.ec2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []*string{out.ContainerInstances[0].Ec2InstanceId},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Could not describe instances")
+	}
+	for _, r := range instances.Reservations {
+		for _, inst := range r.Instances {
+			if ip := aws.StringValue(inst.PrivateIpAddress); ip != "" {
+				return ip, nil
+			}
+		}
+	}
+	return "", errors.Errorf("Instance %s has no private ip", aws.StringValue(out.ContainerInstances[0].Ec2InstanceId))
+}
+
+// dockerID asks the ECS agent on the host for the docker id of the container.
+func (cmd *Exec) dockerID(host, taskArn, container string) (string, error) {
+	args := sshArgs(cmd.User, host, cmd.Bastion, cmd.Key, false, "curl", "-s", agentTasksURL+"?taskarn="+taskArn)
+	data, err := exec.Command("ssh", args...).Output()
+	if err != nil {
+		return "", errors.Wrap(err, "Could not query the ecs agent")
+	}
+	return agentDockerID(data, container)
+}
+
+func (cmd *Exec) ssh(host string, tty bool, remote ...string) error {
+	c := exec.Command("ssh", sshArgs(cmd.User, host, cmd.Bastion, cmd.Key, tty, remote...)...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// SSH opens a shell on the container instance running a task.
+type SSH struct {
+	Exec
+}
+
+func (cmd *SSH) ShortDescription() string { return "Open a shell on a task's instance" }
+
+func (cmd *SSH) Run(w io.Writer) error {
+	cmd.host = true
+	return cmd.Exec.Run(w)
+}
+
+// taskContainer returns the named container of the task, or the first one.
+func taskContainer(task *ecs.Task, name string) (string, error) {
+	for _, c := range task.Containers {
+		if name == "" || aws.StringValue(c.Name) == name {
+			return aws.StringValue(c.Name), nil
+		}
+	}
+	return "", errors.Errorf("Container %s not found in task %s", name, shortName(aws.StringValue(task.TaskArn)))
+}
+
+// agentDockerID finds the container in the ECS agent tasks response.
+func agentDockerID(data []byte, container string) (string, error) {
+	task := struct {
+		Containers []struct {
+			DockerId string
+			Name     string
+		}
+	}{}
+	err := json.Unmarshal(data, &task)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not read the ecs agent response")
+	}
+	for _, c := range task.Containers {
+		if c.Name == container {
+			return c.DockerId, nil
+		}
+	}
+	return "", errors.Errorf("Container %s is not running on the instance", container)
+}
+
+func sshArgs(user, host, bastion, key string, tty bool, remote ...string) []string {
+	args := []string{}
+	if tty {
+		args = append(args, "-t")
+	}
+	if key != "" {
+		args = append(args, "-i", key)
+	}
+	if bastion != "" {
+		if !strings.Contains(bastion, "@") {
+			bastion = user + "@" + bastion
+		}
+		args = append(args, "-J", bastion)
+	}
+	args = append(args, user+"@"+host)
+	for _, arg := range remote {
+		args = append(args, shellQuote(arg))
+	}
+	return args
+}
+
+// shellQuote quotes an argument for the remote shell ssh runs commands in.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=./:") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,57 @@
+package actions
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSSHArgs(t *testing.T) {
+	assert.Equal(t, []string{"ec2-user@10.0.0.1"}, sshArgs("ec2-user", "10.0.0.1", "", "", false))
+	assert.Equal(t,
+		[]string{"-t", "-i", "key.pem", "-J", "ec2-user@bastion", "ec2-user@10.0.0.1", "docker", "exec", "-it", "abc", "sh", "-c", "'echo $HOME'"},
+		sshArgs("ec2-user", "10.0.0.1", "bastion", "key.pem", true, "docker", "exec", "-it", "abc", "sh", "-c", "echo $HOME"),
+	)
+	assert.Equal(t, []string{"-J", "admin@bastion", "ec2-user@10.0.0.1"}, sshArgs("ec2-user", "10.0.0.1", "admin@bastion", "", false))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
+
+func TestAgentDockerID(t *testing.T) {
+	data := []byte(`{"Arn":"arn:task","Containers":[{"DockerId":"abc","Name":"web"},{"DockerId":"def","Name":"proxy"}]}`)
+
+	id, err := agentDockerID(data, "proxy")
+	assert.Nil(t, err)
+	assert.Equal(t, "def", id)
+
+	_, err = agentDockerID(data, "missing")
+	assert.EqualError(t, err, "Container missing is not running on the instance")
+}
+
+func TestTaskContainer(t *testing.T) {
+	task := &ecs.Task{
+		TaskArn:    aws.String("arn:aws:ecs:us-west-2:123:task/t1"),
+		Containers: []*ecs.Container{{Name: aws.String("web")}, {Name: aws.String("proxy")}},
+	}
+
+	name, err := taskContainer(task, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "web", name)
+
+	name, err = taskContainer(task, "proxy")
+	assert.Nil(t, err)
+	assert.Equal(t, "proxy", name)
+
+	_, err = taskContainer(task, "db")
+	assert.EqualError(t, err, "Container db not found in task t1")
+}
+
+func TestExec_FindHostFargate(t *testing.T) {
+	cmd := &Exec{}
+	_, err := cmd.findHost(context.Background(), &ecs.Task{
+		TaskArn:    aws.String("arn:aws:ecs:us-west-2:123:task/t1"),
+		LaunchType: aws.String(ecs.LaunchTypeFargate),
+	})
+	assert.EqualError(t, err, "Task t1 has no container instance to connect to, Fargate tasks are not supported")
+}
@@ -0,0 +1,196 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The directories specs are exported to, the same layout as resources/.
+var exportDirs = map[string]string{
+	"Service":        "services",
+	"TaskDefinition": "task_definitions",
+	"CronJob":        "cron_jobs",
+}
+
+type Export struct {
+	Globals
+	Service string
+	Dir     string
+	Force   bool
+}
+
+func (cmd *Export) ShortDescription() string { return "Export live resources to yaml" }
+
+func (cmd *Export) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.Service, "service", "", "Only export this service and its task definition")
+	fs.StringVar(&cmd.Dir, "dir", "resources", "Directory to write the resource files to")
+	fs.BoolVar(&cmd.Force, "force", false, "Overwrite existing resource files")
+}
+
+func (cmd *Export) Run(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	sess, err := getSession(cmd.Globals)
+	if err != nil {
+		return errors.Wrap(err, "Could not open aws session")
+	}
+	get := &Get{Globals: cmd.Globals, ecs: ecs.New(sess)}
+
+	if cmd.Service != "" {
+		get.IDs = []string{cmd.Service}
+	}
+	services, err := get.services(ctx)
+	if err != nil {
+		return err
+	}
+
+	specs := []*Spec{}
+	taskDefs := []string{}
+	for _, item := range services.items {
+		spec := item.(*Spec)
+		input := &ecs.CreateServiceInput{}
+		if err := json.Unmarshal(spec.Spec, input); err != nil {
+			return err
+		}
+		// Export the revision the service runs and reference its family so the
+		// service follows the exported task definition.
+		taskDef := shortName(aws.StringValue(input.TaskDefinition))
+		input.TaskDefinition = aws.String(taskDefinitionFamily(taskDef))
+		specs = append(specs, newSpec(spec.Type, spec.ID, spec.Cluster, input))
+		taskDefs = append(taskDefs, taskDef)
+	}
+
+	if cmd.Service == "" {
+		get.kv, err = kv.NewDynamoDB(sess)
+		if err != nil {
+			return errors.Wrap(err, "Could not open dynamodb session")
+		}
+		get.IDs = nil
+		jobs, err := get.cronJobs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range jobs.items {
+			spec := item.(*Spec)
+			job := &cronJob{}
+			if err := json.Unmarshal(spec.Spec, job); err != nil {
+				return err
+			}
+			if job.Cluster != cmd.Cluster {
+				continue
+			}
+			specs = append(specs, spec)
+			taskDefs = append(taskDefs, job.TaskDefinitionID)
+		}
+	}
+
+	if len(taskDefs) > 0 {
+		get.IDs = unique(taskDefs)
+		list, err := get.taskDefinitions(ctx)
+		if err != nil {
+			return err
+		}
+		// Services and cron jobs may run different revisions of a family,
+		// these are exported as <family>-<revision>.
+		families := map[string]int{}
+		for _, item := range list.items {
+			families[item.(*Spec).ID]++
+		}
+		for i, item := range list.items {
+			spec := item.(*Spec)
+			if families[spec.ID] > 1 {
+				spec.ID += "-" + list.rows[i][1]
+			}
+			specs = append(specs, spec)
+		}
+	}
+
+	sortSpecs(specs)
+	return cmd.export(w, specs)
+}
+
+// export writes each spec to its own file. Nothing is written when a file
+// already exists, unless -force is set.
+func (cmd *Export) export(w io.Writer, specs []*Spec) error {
+	files := make([]string, len(specs))
+	seen := map[string]bool{}
+	for i, spec := range specs {
+		files[i] = filepath.Join(cmd.Dir, exportDirs[spec.Type], spec.ID+".yml")
+		if seen[files[i]] {
+			return errors.Errorf("More than one resource would be exported to %s", files[i])
+		}
+		seen[files[i]] = true
+
+		if cmd.Force {
+			continue
+		}
+		_, err := os.Stat(files[i])
+		if err == nil {
+			return errors.Errorf("%s already exists, use -force to overwrite it", files[i])
+		}
+		if !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Could not check %s", files[i])
+		}
+	}
+
+	for i, spec := range specs {
+		err := cmd.write(spec, files[i])
+		if err != nil {
+			return err
+		}
+		io.WriteString(w, fmt.Sprintf("Exported %s to %s\n", spec, files[i]))
+	}
+	return nil
+}
+
+func (cmd *Export) write(spec *Spec, file string) error {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return errors.Wrap(err, "Could not create directory")
+	}
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(file, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Could not write file")
+	}
+	return nil
+}
+
+// taskDefinitionFamily returns the family of a task definition ARN or
+// family:revision identifier.
+func taskDefinitionFamily(id string) string {
+	id = shortName(id)
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
+
+func unique(items []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, item := range items {
+		if item != "" && !seen[item] {
+			seen[item] = true
+			out = append(out, item)
+		}
+	}
+	return out
+}
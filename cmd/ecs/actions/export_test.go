@@ -0,0 +1,53 @@
+package actions
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	specs := []*Spec{
+		testSpec("TaskDefinition", "web-2", "", `{"family": "web", "containerDefinitions": [{"name": "web", "image": "web:1"}]}`),
+		testSpec("TaskDefinition", "web-3", "", `{"family": "web", "containerDefinitions": [{"name": "web", "image": "web:2"}]}`),
+		testSpec("Service", "web", "default", `{"serviceName": "web", "taskDefinition": "web"}`),
+	}
+	cmd := &Export{Dir: dir}
+	w := &bytes.Buffer{}
+	assert.Nil(t, cmd.export(w, specs))
+	assert.Contains(t, w.String(), "Exported TaskDefinition/web-2 to "+filepath.Join(dir, "task_definitions", "web-2.yml"))
+
+	read, err := readSpecs(dir, nil)
+	assert.Nil(t, err)
+	ids := []string{}
+	for _, spec := range read {
+		ids = append(ids, spec.String())
+	}
+	assert.Equal(t, []string{"TaskDefinition/web-2", "TaskDefinition/web-3", "Service/web"}, ids)
+
+	// Existing files are left alone without -force.
+	ioutil.WriteFile(filepath.Join(dir, "services", "web.yml"), []byte("edited"), 0644)
+	err = cmd.export(w, specs)
+	assert.EqualError(t, err, filepath.Join(dir, "task_definitions", "web-2.yml")+" already exists, use -force to overwrite it")
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "services", "web.yml"))
+	assert.Equal(t, "edited", string(data))
+
+	cmd.Force = true
+	assert.Nil(t, cmd.export(w, specs))
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "services", "web.yml"))
+	assert.Contains(t, string(data), "serviceName: web")
+}
+
+func TestExport_SameFile(t *testing.T) {
+	cmd := &Export{Dir: "resources", Force: true}
+	specs := []*Spec{testSpec("TaskDefinition", "web", "", `{}`), testSpec("TaskDefinition", "web", "", `{}`)}
+	err := cmd.export(&bytes.Buffer{}, specs)
+	assert.EqualError(t, err, "More than one resource would be exported to resources/task_definitions/web.yml")
+}
@@ -0,0 +1,510 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The resource types that can be listed, keyed by every accepted name.
+var resourceTypes = map[string]string{
+	"service":         "services",
+	"services":        "services",
+	"task":            "tasks",
+	"tasks":           "tasks",
+	"taskdefinition":  "taskdefinitions",
+	"taskdefinitions": "taskdefinitions",
+	"cronjob":         "cronjobs",
+	"cronjobs":        "cronjobs",
+	"instance":        "instances",
+	"instances":       "instances",
+}
+
+type Get struct {
+	Globals
+	Type          string
+	IDs           []string
+	History       bool
+	defaultOutput string
+	ecs           *ecs.ECS
+	kv            kv.DB
+}
+
+func (cmd *Get) ShortDescription() string { return "List resources" }
+func (cmd *Get) ArgsUsage() string {
+	return "services|tasks|taskdefinitions|cronjobs|instances [id...]"
+}
+
+func (cmd *Get) Flags(fs *flag.FlagSet) {
+	cmd.defaultOutput = "table"
+	fs.BoolVar(&cmd.History, "history", false, "List the recent runs of a cron job")
+}
+
+func (cmd *Get) SetArgs(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Missing resource type")
+	}
+	cmd.Type = args[0]
+	cmd.IDs = args[1:]
+	return nil
+}
+
+func (cmd *Get) Run(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	typ, ok := resourceTypes[strings.ToLower(cmd.Type)]
+	if !ok {
+		return errors.Errorf("Could not recognize type %s", cmd.Type)
+	}
+	if cmd.Output == "" {
+		cmd.Output = cmd.defaultOutput
+	}
+	if cmd.Output != "table" && cmd.Output != "json" && cmd.Output != "yaml" {
+		return errors.Errorf("Could not recognize output %s", cmd.Output)
+	}
+	if cmd.History && (typ != "cronjobs" || len(cmd.IDs) != 1) {
+		return &UsageError{Message: "History requires a single cron job"}
+	}
+
+	sess, err := getSession(cmd.Globals)
+	if err != nil {
+		return errors.Wrap(err, "Could not open aws session")
+	}
+	cmd.ecs = ecs.New(sess)
+
+	var list *resourceList
+	switch typ {
+	case "services":
+		list, err = cmd.services(ctx)
+	case "tasks":
+		list, err = cmd.tasks(ctx)
+	case "taskdefinitions":
+		list, err = cmd.taskDefinitions(ctx)
+	case "cronjobs":
+		cmd.kv, err = kv.NewDynamoDB(sess)
+		if err != nil {
+			return errors.Wrap(err, "Could not open dynamodb session")
+		}
+		if cmd.History {
+			list, err = cmd.cronRuns(ctx, cmd.IDs[0])
+		} else {
+			list, err = cmd.cronJobs(ctx)
+		}
+	case "instances":
+		list, err = cmd.instances(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return list.write(w, cmd.Output, len(cmd.IDs) == 1 && !cmd.History)
+}
+
+// resourceList holds fetched resources as table rows and as the items printed
+// for json and yaml output. Items are specs where the type can be applied.
+type resourceList struct {
+	header []string
+	rows   [][]string
+	items  []interface{}
+}
+
+func (list *resourceList) add(item interface{}, row ...string) {
+	list.items = append(list.items, item)
+	list.rows = append(list.rows, row)
+}
+
+func (list *resourceList) write(w io.Writer, output string, single bool) error {
+	switch output {
+	case "json":
+		var v interface{} = list.items
+		if single && len(list.items) == 1 {
+			v = list.items[0]
+		}
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		w.Write(append(data, '\n'))
+	case "yaml":
+		for i, item := range list.items {
+			data, err := yaml.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				io.WriteString(w, "---\n")
+			}
+			w.Write(data)
+		}
+	default:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		io.WriteString(tw, strings.Join(list.header, "\t")+"\n")
+		for _, row := range list.rows {
+			io.WriteString(tw, strings.Join(row, "\t")+"\n")
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+func (cmd *Get) services(ctx context.Context) (*resourceList, error) {
+	arns := aws.StringSlice(cmd.IDs)
+	if len(arns) == 0 {
+		err := cmd.ecs.ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{
+			Cluster: aws.String(cmd.Cluster),
+		}, func(out *ecs.ListServicesOutput, last bool) bool {
+			arns = append(arns, out.ServiceArns...)
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list services")
+		}
+	}
+
+	list := &resourceList{header: []string{"NAME", "STATUS", "DESIRED", "RUNNING", "PENDING", "TASK DEFINITION"}}
+	for _, batch := range batches(arns, 10) {
+		out, err := cmd.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(cmd.Cluster),
+			Services: batch,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get services")
+		}
+		if err := describeFailures(out.Failures); err != nil {
+			return nil, err
+		}
+		for _, svc := range out.Services {
+			list.add(serviceSpec(svc),
+				aws.StringValue(svc.ServiceName),
+				aws.StringValue(svc.Status),
+				fmt.Sprint(aws.Int64Value(svc.DesiredCount)),
+				fmt.Sprint(aws.Int64Value(svc.RunningCount)),
+				fmt.Sprint(aws.Int64Value(svc.PendingCount)),
+				shortName(aws.StringValue(svc.TaskDefinition)),
+			)
+		}
+	}
+	return list, nil
+}
+
+func (cmd *Get) tasks(ctx context.Context) (*resourceList, error) {
+	arns := aws.StringSlice(cmd.IDs)
+	if len(arns) == 0 {
+		err := cmd.ecs.ListTasksPagesWithContext(ctx, &ecs.ListTasksInput{
+			Cluster: aws.String(cmd.Cluster),
+		}, func(out *ecs.ListTasksOutput, last bool) bool {
+			arns = append(arns, out.TaskArns...)
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list tasks")
+		}
+	}
+
+	list := &resourceList{header: []string{"ID", "TASK DEFINITION", "STATUS", "DESIRED", "STARTED BY", "STARTED"}}
+	for _, batch := range batches(arns, 100) {
+		out, err := cmd.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(cmd.Cluster),
+			Tasks:   batch,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get tasks")
+		}
+		if err := describeFailures(out.Failures); err != nil {
+			return nil, err
+		}
+		for _, task := range out.Tasks {
+			list.add(toDocument(task),
+				shortName(aws.StringValue(task.TaskArn)),
+				shortName(aws.StringValue(task.TaskDefinitionArn)),
+				aws.StringValue(task.LastStatus),
+				aws.StringValue(task.DesiredStatus),
+				aws.StringValue(task.StartedBy),
+				formatTime(task.StartedAt),
+			)
+		}
+	}
+	return list, nil
+}
+
+func (cmd *Get) taskDefinitions(ctx context.Context) (*resourceList, error) {
+	ids := cmd.IDs
+	if len(ids) == 0 {
+		err := cmd.ecs.ListTaskDefinitionFamiliesPagesWithContext(ctx, &ecs.ListTaskDefinitionFamiliesInput{},
+			func(out *ecs.ListTaskDefinitionFamiliesOutput, last bool) bool {
+				ids = append(ids, aws.StringValueSlice(out.Families)...)
+				return true
+			})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list task definition families")
+		}
+	}
+
+	list := &resourceList{header: []string{"FAMILY", "REVISION", "STATUS", "IMAGES"}}
+	for _, id := range ids {
+		out, err := cmd.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: aws.String(id),
+			Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
+		})
+		if err != nil && len(cmd.IDs) == 0 && isNotFound(err) {
+			// Families with only inactive revisions.
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not get task definition %s", id)
+		}
+		td := out.TaskDefinition
+		images := []string{}
+		for _, c := range td.ContainerDefinitions {
+			images = append(images, aws.StringValue(c.Image))
+		}
+		list.add(taskDefinitionSpec(out),
+			aws.StringValue(td.Family),
+			fmt.Sprint(aws.Int64Value(td.Revision)),
+			aws.StringValue(td.Status),
+			strings.Join(images, ","),
+		)
+	}
+	return list, nil
+}
+
+func (cmd *Get) cronJobs(ctx context.Context) (*resourceList, error) {
+	keys := cmd.IDs
+	if len(keys) == 0 {
+		var err error
+		keys, err = cmd.kv.Keys(ctx, "CronJob")
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list cron jobs")
+		}
+	}
+
+	list := &resourceList{header: []string{"NAME", "SCHEDULE", "CLUSTER", "TASK DEFINITION", "REPLICAS", "LAST RUN"}}
+	for _, key := range keys {
+		job := &cronJob{}
+		err := cmd.kv.Get(ctx, "CronJob", key, job)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not get cron job %s", key)
+		}
+		lastRun := formatTime(&job.LastRun)
+		list.add(cronJobSpec(key, job),
+			key,
+			job.Schedule,
+			job.Cluster,
+			job.TaskDefinitionID,
+			fmt.Sprint(job.Replicas),
+			lastRun,
+		)
+	}
+	return list, nil
+}
+
+func (cmd *Get) instances(ctx context.Context) (*resourceList, error) {
+	arns := aws.StringSlice(cmd.IDs)
+	if len(arns) == 0 {
+		err := cmd.ecs.ListContainerInstancesPagesWithContext(ctx, &ecs.ListContainerInstancesInput{
+			Cluster: aws.String(cmd.Cluster),
+		}, func(out *ecs.ListContainerInstancesOutput, last bool) bool {
+			arns = append(arns, out.ContainerInstanceArns...)
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list container instances")
+		}
+	}
+
+	list := &resourceList{header: []string{"ID", "EC2 INSTANCE", "STATUS", "AGENT", "RUNNING", "PENDING", "CPU", "MEMORY"}}
+	for _, batch := range batches(arns, 100) {
+		out, err := cmd.ecs.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+			Cluster:            aws.String(cmd.Cluster),
+			ContainerInstances: batch,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get container instances")
+		}
+		if err := describeFailures(out.Failures); err != nil {
+			return nil, err
+		}
+		for _, inst := range out.ContainerInstances {
+			agent := "disconnected"
+			if aws.BoolValue(inst.AgentConnected) {
+				agent = "connected"
+			}
+			list.add(toDocument(inst),
+				shortName(aws.StringValue(inst.ContainerInstanceArn)),
+				aws.StringValue(inst.Ec2InstanceId),
+				aws.StringValue(inst.Status),
+				agent,
+				fmt.Sprint(aws.Int64Value(inst.RunningTasksCount)),
+				fmt.Sprint(aws.Int64Value(inst.PendingTasksCount)),
+				formatUsage(inst, "CPU"),
+				formatUsage(inst, "MEMORY"),
+			)
+		}
+	}
+	return list, nil
+}
+
+// cronRuns lists the runs the scheduler kept for the job, newest first.
+func (cmd *Get) cronRuns(ctx context.Context, job string) (*resourceList, error) {
+	keys, err := cmd.kv.Keys(ctx, "CronRun")
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list cron job runs")
+	}
+	runs := []string{}
+	for _, key := range keys {
+		if name, ok := runJobKey(key); ok && name == job {
+			runs = append(runs, key)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(runs)))
+
+	list := &resourceList{header: []string{"SCHEDULED", "STARTED", "STOPPED", "STATUS", "TASKS", "EXIT CODES", "REASON"}}
+	for _, key := range runs {
+		run := &cronRun{}
+		err := cmd.kv.Get(ctx, "CronRun", key, run)
+		if err == kv.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not get cron job run %s", key)
+		}
+		codes := []string{}
+		for _, exit := range run.Exits {
+			code := "-"
+			if exit.ExitCode != nil {
+				code = fmt.Sprint(*exit.ExitCode)
+			}
+			codes = append(codes, exit.Container+"="+code)
+		}
+		status := run.Status
+		if status == "" {
+			status = "Starting"
+		}
+		list.add(run,
+			formatTime(&run.Scheduled),
+			formatTime(&run.Claimed),
+			formatTime(&run.Stopped),
+			status,
+			fmt.Sprint(len(run.Tasks)),
+			strings.Join(codes, ","),
+			run.Reason,
+		)
+	}
+	return list, nil
+}
+
+// Describe prints single resources in full.
+type Describe struct {
+	Get
+}
+
+func (cmd *Describe) ShortDescription() string { return "Describe a resource" }
+func (cmd *Describe) ArgsUsage() string {
+	return "services|tasks|taskdefinitions|cronjobs|instances <id>..."
+}
+
+func (cmd *Describe) Flags(fs *flag.FlagSet) {
+	cmd.defaultOutput = "yaml"
+}
+
+func (cmd *Describe) SetArgs(args []string) error {
+	if len(args) < 2 {
+		return errors.New("Describe requires a type and at least one id")
+	}
+	return cmd.Get.SetArgs(args)
+}
+
+func describeFailures(failures []*ecs.Failure) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	msgs := []string{}
+	for _, f := range failures {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", aws.StringValue(f.Arn), aws.StringValue(f.Reason)))
+	}
+	return errors.Errorf("Could not describe %s", strings.Join(msgs, ", "))
+}
+
+// serviceSpec builds the spec that would create the service.
+func serviceSpec(svc *ecs.Service) *Spec {
+	input := &ecs.CreateServiceInput{}
+	convert(svc, input)
+	cluster := shortName(aws.StringValue(svc.ClusterArn))
+	input.Cluster = aws.String(cluster)
+	input.Role = svc.RoleArn
+	return newSpec("Service", aws.StringValue(svc.ServiceName), cluster, input)
+}
+
+// taskDefinitionSpec builds the spec that would register the task definition,
+// including its tags when they were described.
+func taskDefinitionSpec(out *ecs.DescribeTaskDefinitionOutput) *Spec {
+	return newSpec("TaskDefinition", aws.StringValue(out.TaskDefinition.Family), "", cloneTaskDefinition(out))
+}
+
+// cronJobSpec builds the spec of a cron job, the last run and its tasks are
+// left out as they are managed by the scheduler, the marker as it is set by
+// apply.
+func cronJobSpec(key string, job *cronJob) *Spec {
+	spec := *job
+	spec.LastRun = time.Time{}
+	spec.Tasks = nil
+	spec.ManagedBy = ""
+	spec.ManifestSet = ""
+	return newSpec("CronJob", key, "", &spec)
+}
+
+func newSpec(typ, id, cluster string, v interface{}) *Spec {
+	data, _ := json.Marshal(toDocument(v))
+	return &Spec{Type: typ, ID: id, Cluster: cluster, Spec: data}
+}
+
+// shortName returns the resource name of an ARN.
+func shortName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// formatUsage shows the reserved and registered amount of a resource.
+func formatUsage(inst *ecs.ContainerInstance, name string) string {
+	registered := resourceValue(inst.RegisteredResources, name)
+	remaining := resourceValue(inst.RemainingResources, name)
+	return fmt.Sprintf("%d/%d", registered-remaining, registered)
+}
+
+func resourceValue(resources []*ecs.Resource, name string) int64 {
+	for _, r := range resources {
+		if aws.StringValue(r.Name) == name {
+			return aws.Int64Value(r.IntegerValue)
+		}
+	}
+	return 0
+}
+
+func batches(items []*string, size int) [][]*string {
+	out := [][]*string{}
+	for len(items) > size {
+		out = append(out, items[:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		out = append(out, items)
+	}
+	return out
+}
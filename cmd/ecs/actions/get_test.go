@@ -0,0 +1,95 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestToDocument(t *testing.T) {
+	doc := toDocument(&ecs.ContainerDefinition{
+		Name:         aws.String("web"),
+		Memory:       aws.Int64(128),
+		DockerLabels: map[string]*string{"Com.Label": aws.String("x")},
+	})
+	assert.Equal(t, map[string]interface{}{
+		"name":         "web",
+		"memory":       int64(128),
+		"dockerLabels": map[string]interface{}{"Com.Label": "x"},
+	}, doc)
+}
+
+func TestGet_YAMLRoundTrip(t *testing.T) {
+	out := &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{
+		Family:            aws.String("web"),
+		Revision:          aws.Int64(3),
+		TaskDefinitionArn: aws.String("arn:aws:ecs:us-west-2:123:task-definition/web:3"),
+		NetworkMode:       aws.String("host"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name:        aws.String("web"),
+			Image:       aws.String("web:1"),
+			Environment: []*ecs.KeyValuePair{{Name: aws.String("A"), Value: aws.String("1")}},
+		}},
+	}, Tags: []*ecs.Tag{{Key: aws.String("team"), Value: aws.String("platform")}}}
+
+	list := &resourceList{}
+	list.add(taskDefinitionSpec(out))
+	buf := &bytes.Buffer{}
+	assert.Nil(t, list.write(buf, "yaml", false))
+
+	f, err := ioutil.TempFile("", "spec")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.Write(buf.Bytes())
+	f.Close()
+
+	specs, err := readSpecFile(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(specs))
+	assert.Empty(t, validateSpec(specs[0]))
+	assert.Equal(t, "TaskDefinition/web", specs[0].String())
+
+	input := &ecs.RegisterTaskDefinitionInput{}
+	assert.Nil(t, json.Unmarshal(specs[0].Spec, input))
+	assert.Equal(t, cloneTaskDefinition(out), input)
+	assert.Equal(t, "platform", aws.StringValue(input.Tags[0].Value))
+}
+
+func TestTaskDefinitionFamily(t *testing.T) {
+	assert.Equal(t, "web", taskDefinitionFamily("arn:aws:ecs:us-west-2:123:task-definition/web:3"))
+	assert.Equal(t, "web", taskDefinitionFamily("web:3"))
+	assert.Equal(t, "web", taskDefinitionFamily("web"))
+}
+
+func TestGet_CronRuns(t *testing.T) {
+	ctx := context.Background()
+	db := kv.NewLocalDB()
+	at := func(h int) time.Time { return time.Date(2017, 05, 04, h, 0, 0, 0, time.UTC) }
+	db.Put(ctx, "CronRun", "nightly/2017-05-04T01:00:00Z", &cronRun{Scheduled: at(1), Status: "Succeeded"})
+	db.Put(ctx, "CronRun", "nightly/2017-05-04T02:00:00Z", &cronRun{
+		Scheduled: at(2),
+		Status:    "Failed",
+		Tasks:     []string{"arn/a"},
+		Reason:    "Essential container in task exited",
+		Exits:     []cronRunExit{{Task: "a", Container: "app", ExitCode: aws.Int64(1)}},
+	})
+	db.Put(ctx, "CronRun", "other/2017-05-04T02:00:00Z", &cronRun{Scheduled: at(2)})
+	db.Put(ctx, "CronRun", "nightly/cleanup/2017-05-04T02:00:00Z", &cronRun{Scheduled: at(2)})
+
+	cmd := &Get{kv: db}
+	list, err := cmd.cronRuns(ctx, "nightly")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list.rows))
+	assert.Equal(t, []string{"Failed", "1", "app=1", "Essential container in task exited"}, list.rows[0][3:])
+	assert.Equal(t, "Succeeded", list.rows[1][3])
+
+	assert.IsType(t, &UsageError{}, (&Get{Globals: Globals{Output: "table"}, Type: "services", History: true}).Run(&bytes.Buffer{}))
+}
@@ -0,0 +1,260 @@
+package actions
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"time"
+)
+
+// How often new log events are fetched when following.
+var logsInterval = 2 * time.Second
+
+// CloudWatchLogs is the part of the CloudWatch Logs API used to read task logs.
+type CloudWatchLogs interface {
+	FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, opts ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error)
+}
+
+type Logs struct {
+	Globals
+	Service   string
+	Container string
+	Since     time.Duration
+	Follow    bool
+	ecs       *ecs.ECS
+	logs      CloudWatchLogs
+}
+
+func (cmd *Logs) ShortDescription() string { return "Print the logs of a service" }
+
+func (cmd *Logs) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.Service, "service", "", "Service name")
+	fs.StringVar(&cmd.Container, "container", "", "Only show logs of this container")
+	fs.DurationVar(&cmd.Since, "since", 10*time.Minute, "Show logs newer than this")
+	fs.BoolVar(&cmd.Follow, "follow", false, "Keep printing new logs")
+}
+
+func (cmd *Logs) Run(w io.Writer) error {
+	sess, err := getSession(cmd.Globals)
+	if err != nil {
+		return errors.Wrap(err, "Could not open aws session")
+	}
+	cmd.ecs = ecs.New(sess)
+	cmd.logs = cloudwatchlogs.New(sess)
+
+	tail := &logTail{
+		client: cmd.logs,
+		start:  time.Now().Add(-cmd.Since),
+		seen:   map[string]int64{},
+	}
+	for {
+		sources, err := cmd.sources()
+		if err != nil {
+			return err
+		}
+		err = tail.print(w, sources)
+		if err != nil {
+			return err
+		}
+		if !cmd.Follow {
+			return nil
+		}
+		time.Sleep(logsInterval)
+	}
+}
+
+// sources finds the log streams of the running and recently stopped tasks of
+// the service.
+func (cmd *Logs) sources() ([]*logSource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	svcs, err := cmd.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(cmd.Cluster),
+		Services: []*string{aws.String(cmd.Service)},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get services")
+	}
+	if len(svcs.Services) == 0 {
+		return nil, errors.Errorf("Service %s not found", cmd.Service)
+	}
+
+	taskDef, err := cmd.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: svcs.Services[0].TaskDefinition,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to describe task definition")
+	}
+
+	taskIDs := []string{}
+	for _, status := range []string{ecs.DesiredStatusRunning, ecs.DesiredStatusStopped} {
+		err = cmd.ecs.ListTasksPagesWithContext(ctx, &ecs.ListTasksInput{
+			Cluster:       aws.String(cmd.Cluster),
+			ServiceName:   aws.String(cmd.Service),
+			DesiredStatus: aws.String(status),
+		}, func(out *ecs.ListTasksOutput, last bool) bool {
+			for _, arn := range out.TaskArns {
+				taskIDs = append(taskIDs, shortName(aws.StringValue(arn)))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list tasks")
+		}
+	}
+
+	return logSources(taskDef.TaskDefinition, taskIDs, cmd.Container)
+}
+
+// logSource is a log group and the streams to read from it, streams map to
+// the task/container prefix printed with each event.
+type logSource struct {
+	group   string
+	streams map[string]string
+}
+
+// logSources works out the awslogs streams of each container in the tasks,
+// streams are named <prefix>/<container>/<task id>. Without a container name,
+// containers that do not log to awslogs, such as sidecars, are skipped.
+func logSources(taskDef *ecs.TaskDefinition, taskIDs []string, container string) ([]*logSource, error) {
+	sources := map[string]*logSource{}
+	found := false
+	for _, c := range taskDef.ContainerDefinitions {
+		name := aws.StringValue(c.Name)
+		if container != "" && name != container {
+			continue
+		}
+		found = true
+
+		config := c.LogConfiguration
+		if config == nil || aws.StringValue(config.LogDriver) != "awslogs" {
+			if container == "" {
+				continue
+			}
+			return nil, errors.Errorf("Container %s does not use the awslogs driver", name)
+		}
+		group := aws.StringValue(config.Options["awslogs-group"])
+		prefix := aws.StringValue(config.Options["awslogs-stream-prefix"])
+		if group == "" || prefix == "" {
+			if container == "" {
+				continue
+			}
+			return nil, errors.Errorf("Container %s needs awslogs-group and awslogs-stream-prefix options", name)
+		}
+
+		source, ok := sources[group]
+		if !ok {
+			source = &logSource{group: group, streams: map[string]string{}}
+			sources[group] = source
+		}
+		for _, id := range taskIDs {
+			source.streams[prefix+"/"+name+"/"+id] = id + "/" + name
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("Container %s not found in task definition", container)
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("No container in the task definition uses the awslogs driver with a stream prefix")
+	}
+
+	out := []*logSource{}
+	for _, source := range sources {
+		out = append(out, source)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].group < out[j].group })
+	return out, nil
+}
+
+type logEvent struct {
+	prefix    string
+	timestamp int64
+	message   string
+}
+
+// logTail prints log events from the sources it has not printed before.
+type logTail struct {
+	client CloudWatchLogs
+	start  time.Time
+	// The timestamps of the printed events by event ID.
+	seen map[string]int64
+}
+
+func (tail *logTail) print(w io.Writer, sources []*logSource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	events := []*logEvent{}
+	for _, source := range sources {
+		streams := []string{}
+		for stream := range source.streams {
+			streams = append(streams, stream)
+		}
+		sort.Strings(streams)
+
+		// FilterLogEvents accepts at most 100 streams.
+		for _, batch := range batches(aws.StringSlice(streams), 100) {
+			err := tail.fetch(ctx, source, batch, &events)
+			if err != nil {
+				return errors.Wrapf(err, "Could not read logs from %s", source.group)
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].timestamp < events[j].timestamp })
+	for _, event := range events {
+		t := time.Unix(0, event.timestamp*int64(time.Millisecond))
+		io.WriteString(w, fmt.Sprintf("[%s] %s %s\n", event.prefix, t.Format(time.RFC3339), event.message))
+		if event.timestamp > tail.start.UnixNano()/int64(time.Millisecond) {
+			tail.start = t
+		}
+	}
+
+	// Events older than the start time are not returned again.
+	start := tail.start.UnixNano() / int64(time.Millisecond)
+	for id, timestamp := range tail.seen {
+		if timestamp < start {
+			delete(tail.seen, id)
+		}
+	}
+	return nil
+}
+
+func (tail *logTail) fetch(ctx context.Context, source *logSource, streams []*string, events *[]*logEvent) error {
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String(source.group),
+		LogStreamNames: streams,
+		StartTime:      aws.Int64(tail.start.UnixNano() / int64(time.Millisecond)),
+		Interleaved:    aws.Bool(true),
+	}
+	for {
+		out, err := tail.client.FilterLogEventsWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, e := range out.Events {
+			id := aws.StringValue(e.EventId)
+			if _, ok := tail.seen[id]; ok {
+				continue
+			}
+			tail.seen[id] = aws.Int64Value(e.Timestamp)
+			*events = append(*events, &logEvent{
+				prefix:    source.streams[aws.StringValue(e.LogStreamName)],
+				timestamp: aws.Int64Value(e.Timestamp),
+				message:   aws.StringValue(e.Message),
+			})
+		}
+		if out.NextToken == nil {
+			return nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
@@ -0,0 +1,134 @@
+package actions
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeLogs struct {
+	pages  []*cloudwatchlogs.FilterLogEventsOutput
+	inputs []cloudwatchlogs.FilterLogEventsInput
+}
+
+func (f *fakeLogs) FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, opts ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	f.inputs = append(f.inputs, *input)
+	if len(f.pages) == 0 {
+		return &cloudwatchlogs.FilterLogEventsOutput{}, nil
+	}
+	page := f.pages[0]
+	f.pages = f.pages[1:]
+	return page, nil
+}
+
+func logEventAt(id, stream, message string, ts int64) *cloudwatchlogs.FilteredLogEvent {
+	return &cloudwatchlogs.FilteredLogEvent{
+		EventId:       aws.String(id),
+		LogStreamName: aws.String(stream),
+		Message:       aws.String(message),
+		Timestamp:     aws.Int64(ts),
+	}
+}
+
+func awslogsContainer(name, group string) *ecs.ContainerDefinition {
+	return &ecs.ContainerDefinition{
+		Name: aws.String(name),
+		LogConfiguration: &ecs.LogConfiguration{
+			LogDriver: aws.String("awslogs"),
+			Options: map[string]*string{
+				"awslogs-group":         aws.String(group),
+				"awslogs-stream-prefix": aws.String("app"),
+			},
+		},
+	}
+}
+
+func TestLogSources(t *testing.T) {
+	taskDef := &ecs.TaskDefinition{ContainerDefinitions: []*ecs.ContainerDefinition{
+		awslogsContainer("web", "web-logs"),
+		awslogsContainer("proxy", "web-logs"),
+	}}
+
+	sources, err := logSources(taskDef, []string{"t1"}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sources))
+	assert.Equal(t, map[string]string{
+		"app/web/t1":   "t1/web",
+		"app/proxy/t1": "t1/proxy",
+	}, sources[0].streams)
+
+	sources, err = logSources(taskDef, []string{"t1"}, "proxy")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"app/proxy/t1": "t1/proxy"}, sources[0].streams)
+
+	_, err = logSources(taskDef, []string{"t1"}, "missing")
+	assert.EqualError(t, err, "Container missing not found in task definition")
+
+	taskDef.ContainerDefinitions[0].LogConfiguration = nil
+	_, err = logSources(taskDef, []string{"t1"}, "web")
+	assert.EqualError(t, err, "Container web does not use the awslogs driver")
+}
+
+func TestLogSources_MixedDrivers(t *testing.T) {
+	taskDef := &ecs.TaskDefinition{ContainerDefinitions: []*ecs.ContainerDefinition{
+		awslogsContainer("web", "web-logs"),
+		{Name: aws.String("router"), LogConfiguration: &ecs.LogConfiguration{LogDriver: aws.String("awsfirelens")}},
+		{Name: aws.String("proxy")},
+	}}
+
+	// Sidecars with other drivers are skipped.
+	sources, err := logSources(taskDef, []string{"t1"}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sources))
+	assert.Equal(t, map[string]string{"app/web/t1": "t1/web"}, sources[0].streams)
+
+	_, err = logSources(taskDef, []string{"t1"}, "router")
+	assert.EqualError(t, err, "Container router does not use the awslogs driver")
+
+	taskDef.ContainerDefinitions = taskDef.ContainerDefinitions[1:]
+	_, err = logSources(taskDef, []string{"t1"}, "")
+	assert.EqualError(t, err, "No container in the task definition uses the awslogs driver with a stream prefix")
+}
+
+func TestLogTail(t *testing.T) {
+	client := &fakeLogs{pages: []*cloudwatchlogs.FilterLogEventsOutput{
+		{
+			Events:    []*cloudwatchlogs.FilteredLogEvent{logEventAt("2", "app/web/t1", "second", 2000)},
+			NextToken: aws.String("next"),
+		},
+		{
+			Events: []*cloudwatchlogs.FilteredLogEvent{logEventAt("1", "app/web/t2", "first", 1000)},
+		},
+		{
+			Events: []*cloudwatchlogs.FilteredLogEvent{
+				logEventAt("2", "app/web/t1", "second", 2000),
+				logEventAt("3", "app/web/t1", "third", 3000),
+			},
+		},
+	}}
+	sources := []*logSource{{
+		group:   "web-logs",
+		streams: map[string]string{"app/web/t1": "t1/web", "app/web/t2": "t2/web"},
+	}}
+	tail := &logTail{client: client, start: time.Unix(0, 0), seen: map[string]int64{}}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, tail.print(buf, sources))
+	assert.Regexp(t, `(?s)^\[t2/web\] \S+ first\n\[t1/web\] \S+ second\n$`, buf.String())
+	assert.Equal(t, "next", aws.StringValue(client.inputs[1].NextToken))
+	assert.Equal(t, []string{"app/web/t1", "app/web/t2"}, aws.StringValueSlice(client.inputs[0].LogStreamNames))
+
+	// Following only prints events not seen before and starts at the last one.
+	buf.Reset()
+	assert.Nil(t, tail.print(buf, sources))
+	assert.Regexp(t, `^\[t1/web\] \S+ third\n$`, buf.String())
+	assert.Equal(t, int64(2000), aws.Int64Value(client.inputs[2].StartTime))
+
+	// Only events at the start time are kept to filter out repeats.
+	assert.Equal(t, map[string]int64{"3": 3000}, tail.seen)
+}
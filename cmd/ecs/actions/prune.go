@@ -0,0 +1,213 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Applied services are tagged with the managed-by marker and their manifest
+// set, cron jobs carry the same marker as attributes. ECS can not be searched
+// by tag across clusters, so applied resources are also indexed under this kv
+// class for prune to find them.
+const managedClass = "Managed"
+
+// The marker of resources applied by this tool.
+const (
+	managedByTag   = "managed-by"
+	managedByValue = "ecs-apply"
+	manifestSetTag = "manifest-set"
+)
+
+// Types that are pruned, task definition revisions are left registered.
+var pruneTypes = map[string]bool{
+	"Service": true,
+	"CronJob": true,
+}
+
+// managedResource marks a resource as applied by this tool. Set is the
+// manifest set it was applied from, prune only deletes resources of its own
+// set.
+type managedResource struct {
+	Type    string
+	ID      string
+	Cluster string
+	Set     string
+	Labels  map[string]string
+	Applied time.Time
+}
+
+func (m *managedResource) String() string {
+	if m.Cluster != "" {
+		return fmt.Sprintf("%s/%s (%s)", m.Type, m.ID, m.Cluster)
+	}
+	return m.Type + "/" + m.ID
+}
+
+func managedKey(spec *Spec) string {
+	if cluster := managedCluster(spec); cluster != "" {
+		return spec.Type + "/" + cluster + "/" + spec.ID
+	}
+	return spec.Type + "/" + spec.ID
+}
+
+// managedCluster returns the cluster a resource is applied to, services may
+// only set it in the spec payload.
+func managedCluster(spec *Spec) string {
+	if spec.Type == "Service" {
+		return serviceCluster(spec)
+	}
+	return spec.Cluster
+}
+
+// parseSelector parses a selector in the form team=payments,env=prod.
+func parseSelector(s string) (map[string]string, error) {
+	selector := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("Selectors must be described as <label>=<value>, received: %s", pair)
+		}
+		selector[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return selector, nil
+}
+
+// matchLabels returns true when every label in the selector is set.
+func matchLabels(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func selectSpecs(specs []*Spec, selector map[string]string) []*Spec {
+	selected := []*Spec{}
+	for _, spec := range specs {
+		if matchLabels(selector, spec.Labels) {
+			selected = append(selected, spec)
+		}
+	}
+	return selected
+}
+
+// tagManaged puts the managed-by marker and manifest set on the applied
+// resource, as ECS tags on services and as attributes on cron jobs.
+func tagManaged(ctx context.Context, c *resourceClients, set string, spec *Spec) error {
+	switch spec.Type {
+	case "Service":
+		out, err := c.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+			Services: []*string{aws.String(spec.ID)},
+			Cluster:  aws.String(serviceCluster(spec)),
+		})
+		if err != nil {
+			return err
+		}
+		svc := activeService(out.Services)
+		if svc == nil {
+			return errors.Errorf("Service %s not found", spec.ID)
+		}
+		_, err = c.ecs.TagResourceWithContext(ctx, &ecs.TagResourceInput{
+			ResourceArn: svc.ServiceArn,
+			Tags: []*ecs.Tag{
+				{Key: aws.String(managedByTag), Value: aws.String(managedByValue)},
+				{Key: aws.String(manifestSetTag), Value: aws.String(set)},
+			},
+		})
+		return errors.Wrap(err, "Could not tag service, tags need the long ARN format")
+	case "CronJob":
+		for i := 0; i < 3; i++ {
+			job := &cronJob{}
+			version, err := c.kv.GetVersion(ctx, spec.Type, spec.ID, job)
+			if err != nil {
+				return err
+			}
+			job.ManagedBy = managedByValue
+			job.ManifestSet = set
+			err = c.kv.PutVersion(ctx, spec.Type, spec.ID, job, version)
+			if err != kv.ErrConflict {
+				return err
+			}
+		}
+		return errors.New("Could not mark CronJob as managed, it is being updated concurrently")
+	}
+	return nil
+}
+
+func markManaged(ctx context.Context, db kv.DB, set string, spec *Spec) error {
+	if !pruneTypes[spec.Type] {
+		return nil
+	}
+	return db.Put(ctx, managedClass, managedKey(spec), &managedResource{
+		Type:    spec.Type,
+		ID:      spec.ID,
+		Cluster: managedCluster(spec),
+		Set:     set,
+		Labels:  spec.Labels,
+		Applied: time.Now(),
+	})
+}
+
+// pruneCandidates returns the managed resources of the set matching the
+// selector that are missing from the specs. The specs are every spec read for
+// the set, before the selector is applied, so a spec whose labels no longer
+// match is not pruned. Dependents are returned first.
+func pruneCandidates(ctx context.Context, db kv.DB, set string, selector map[string]string, specs []*Spec) ([]*managedResource, error) {
+	applied := map[string]bool{}
+	for _, spec := range specs {
+		applied[managedKey(spec)] = true
+	}
+
+	keys, err := db.Keys(ctx, managedClass)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list managed resources")
+	}
+	sort.Strings(keys)
+
+	candidates := []*managedResource{}
+	for _, key := range keys {
+		if applied[key] {
+			continue
+		}
+		m := &managedResource{}
+		err = db.Get(ctx, managedClass, key, m)
+		if err == kv.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not read managed resource %s", key)
+		}
+		if m.Set == set && matchLabels(selector, m.Labels) {
+			candidates = append(candidates, m)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return specOrder[candidates[i].Type] > specOrder[candidates[j].Type]
+	})
+	return candidates, nil
+}
+
+func pruneResource(ctx context.Context, c *resourceClients, m *managedResource) error {
+	r, err := newResource(m.Type, c)
+	if err != nil {
+		return err
+	}
+	spec := &Spec{Type: m.Type, ID: m.ID, Cluster: m.Cluster}
+	err = r.Delete(ctx, spec)
+	if err != nil {
+		return err
+	}
+	return c.kv.Del(ctx, managedClass, managedKey(spec))
+}
@@ -0,0 +1,156 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	selector, err := parseSelector("team=payments, env=prod")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", "env": "prod"}, selector)
+
+	_, err = parseSelector("team")
+	assert.EqualError(t, err, "Selectors must be described as <label>=<value>, received: team")
+}
+
+func TestPruneCandidates(t *testing.T) {
+	ctx := context.Background()
+	db := kv.NewLocalDB()
+	payments := map[string]string{"team": "payments"}
+
+	web := &Spec{Type: "Service", ID: "web", Cluster: "default", Labels: payments}
+	api := &Spec{Type: "Service", ID: "api", Cluster: "default", Labels: payments}
+	nightly := &Spec{Type: "CronJob", ID: "nightly", Labels: payments}
+	other := &Spec{Type: "Service", ID: "other", Cluster: "default", Labels: map[string]string{"team": "search"}}
+	for _, spec := range []*Spec{web, api, nightly, other, {Type: "TaskDefinition", ID: "web", Labels: payments}} {
+		assert.Nil(t, markManaged(ctx, db, "", spec))
+	}
+
+	candidates, err := pruneCandidates(ctx, db, "", payments, []*Spec{web})
+	assert.Nil(t, err)
+	names := []string{}
+	for _, m := range candidates {
+		names = append(names, m.String())
+	}
+	assert.Equal(t, []string{"CronJob/nightly", "Service/api (default)"}, names)
+}
+
+func TestPruneCandidates_SpecCluster(t *testing.T) {
+	ctx := context.Background()
+	db := kv.NewLocalDB()
+	payments := map[string]string{"team": "payments"}
+
+	// The cluster is only set in the spec, as in resources/services.
+	web := testSpec("Service", "web", "", `{"serviceName": "web", "cluster": "prod"}`)
+	web.Labels = payments
+	assert.Nil(t, markManaged(ctx, db, "", web))
+
+	keys, _ := db.Keys(ctx, managedClass)
+	assert.Equal(t, []string{"Service/prod/web"}, keys)
+
+	candidates, err := pruneCandidates(ctx, db, "", payments, []*Spec{web})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(candidates))
+
+	candidates, err = pruneCandidates(ctx, db, "", payments, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "prod", candidates[0].Cluster)
+}
+
+func TestPruneCandidates_Set(t *testing.T) {
+	ctx := context.Background()
+	db := kv.NewLocalDB()
+	payments := map[string]string{"team": "payments"}
+	markManaged(ctx, db, "billing", &Spec{Type: "Service", ID: "invoices", Cluster: "default", Labels: payments})
+	markManaged(ctx, db, "checkout", &Spec{Type: "Service", ID: "cart", Cluster: "default", Labels: payments})
+
+	candidates, err := pruneCandidates(ctx, db, "billing", payments, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(candidates))
+	assert.Equal(t, "invoices", candidates[0].ID)
+}
+
+func TestPruneCandidates_LabelsChanged(t *testing.T) {
+	ctx := context.Background()
+	db := kv.NewLocalDB()
+	payments := map[string]string{"team": "payments"}
+	markManaged(ctx, db, "", &Spec{Type: "Service", ID: "web", Cluster: "default", Labels: payments})
+
+	// The spec moved to another team, it is no longer selected but still read.
+	web := &Spec{Type: "Service", ID: "web", Cluster: "default", Labels: map[string]string{"team": "search"}}
+	assert.Equal(t, 0, len(selectSpecs([]*Spec{web}, payments)))
+	candidates, err := pruneCandidates(ctx, db, "", payments, []*Spec{web})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(candidates))
+}
+
+func TestTagManaged(t *testing.T) {
+	ctx := context.Background()
+	m := &MockECS{}
+	c := &resourceClients{ecs: m, kv: kv.NewLocalDB()}
+
+	m.On("DescribeServicesWithContext", mock.Anything).Return(&ecs.DescribeServicesOutput{Services: []*ecs.Service{{
+		ServiceArn: aws.String("arn:aws:ecs:us-west-2:123:service/default/web"),
+		Status:     aws.String("ACTIVE"),
+	}}}, nil)
+	m.On("TagResourceWithContext", &ecs.TagResourceInput{
+		ResourceArn: aws.String("arn:aws:ecs:us-west-2:123:service/default/web"),
+		Tags: []*ecs.Tag{
+			{Key: aws.String("managed-by"), Value: aws.String("ecs-apply")},
+			{Key: aws.String("manifest-set"), Value: aws.String("billing")},
+		},
+	}).Return(nil).Once()
+	assert.Nil(t, tagManaged(ctx, c, "billing", testSpec("Service", "web", "default", `{"serviceName": "web"}`)))
+	m.AssertExpectations(t)
+
+	c.kv.Put(ctx, "CronJob", "nightly", &cronJob{Schedule: "0 0 * * *", Tasks: []string{"task/1"}})
+	assert.Nil(t, tagManaged(ctx, c, "billing", &Spec{Type: "CronJob", ID: "nightly"}))
+	job := &cronJob{}
+	c.kv.Get(ctx, "CronJob", "nightly", job)
+	assert.Equal(t, &cronJob{Schedule: "0 0 * * *", Tasks: []string{"task/1"}, ManagedBy: "ecs-apply", ManifestSet: "billing"}, job)
+}
+
+func TestApply_Prune(t *testing.T) {
+	db := kv.NewLocalDB()
+	m := &MockECS{}
+	payments := map[string]string{"team": "payments"}
+	ctx := context.Background()
+	markManaged(ctx, db, "", &Spec{Type: "Service", ID: "web", Cluster: "default", Labels: payments})
+	markManaged(ctx, db, "", &Spec{Type: "Service", ID: "old", Cluster: "default", Labels: payments})
+
+	m.On("UpdateServiceWithContext", &ecs.UpdateServiceInput{
+		Service:      aws.String("old"),
+		Cluster:      aws.String("default"),
+		DesiredCount: aws.Int64(0),
+	}).Return(nil).Once()
+	m.On("DeleteServiceWithContext", &ecs.DeleteServiceInput{
+		Service: aws.String("old"),
+		Cluster: aws.String("default"),
+	}).Return(nil).Once()
+
+	specs := []*Spec{{Type: "Service", ID: "web", Cluster: "default", Labels: payments}}
+
+	// Declining leaves everything in place.
+	cmd := &Apply{ecs: m, kv: db, stdin: strings.NewReader("n\n")}
+	w := &bytes.Buffer{}
+	assert.Nil(t, cmd.prune(w, payments, specs))
+	assert.Contains(t, w.String(), "Service/old (default)")
+	assert.Contains(t, w.String(), "Skipped prune")
+
+	cmd.stdin = strings.NewReader("y\n")
+	w.Reset()
+	assert.Nil(t, cmd.prune(w, payments, specs))
+	assert.Contains(t, w.String(), "Service/old (default): deleted")
+	m.AssertExpectations(t)
+
+	keys, _ := db.Keys(ctx, managedClass)
+	assert.Equal(t, []string{"Service/default/web"}, keys)
+}
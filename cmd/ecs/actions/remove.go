@@ -3,7 +3,6 @@ package actions
 import (
 	"context"
 	"flag"
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/coldog/tool-ecs/internal/kv"
 	"github.com/pkg/errors"
@@ -13,65 +12,41 @@ import (
 )
 
 type Remove struct {
-	flag   *flag.FlagSet
-	Type   string
-	ID     string
-	Region string
-	ecs    *ecs.ECS
+	Globals
+	Type string
+	ID   string
 }
 
 func (cmd *Remove) ShortDescription() string { return "Remove a resource" }
-func (cmd *Remove) PrintUsage()              { cmd.flag.PrintDefaults() }
 
-func (cmd *Remove) ParseArgs(args []string) {
-	cmd.flag = flag.NewFlagSet("Apply", flag.ExitOnError)
-	cmd.flag.StringVar(&cmd.Region, "region", "us-west-2", "AWS Region")
-	cmd.flag.StringVar(&cmd.Type, "type", "", "Type to remove")
-	cmd.flag.StringVar(&cmd.ID, "id", "", "ID to remove")
-	cmd.flag.Parse(args)
+func (cmd *Remove) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.Type, "type", "", "Type to remove")
+	fs.StringVar(&cmd.ID, "id", "", "ID to remove")
 }
 
 func (cmd *Remove) Run(w io.Writer) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	sess, err := getSession(cmd.Region)
+	sess, err := getSession(cmd.Globals)
 	if err != nil {
 		return errors.Wrap(err, "Could not open aws session")
 	}
 
-	ecsClient := ecs.New(sess)
 	kvClient, err := kv.NewDynamoDB(sess)
 	if err != nil {
 		return errors.Wrap(err, "Could not open dynamodb session")
 	}
 
-	cmd.ecs = ecsClient
-
-	switch cmd.Type {
-	case "CronJob":
-		return kvClient.Del(ctx, cmd.Type, cmd.ID)
-	case "TaskDefinition":
-		return cmd.handleTaskDefinition(ctx, cmd.ID)
-	case "Service":
-		return cmd.handleService(ctx, cmd.ID)
-	default:
-		return errors.Errorf("Could not recognize type %s", cmd.Type)
+	r, err := newResource(cmd.Type, &resourceClients{ecs: ecs.New(sess), kv: kvClient})
+	if err != nil {
+		return err
 	}
-}
 
-func (cmd *Remove) handleTaskDefinition(ctx context.Context, id string) error {
-	_, err := cmd.ecs.DeregisterTaskDefinitionWithContext(ctx, &ecs.DeregisterTaskDefinitionInput{
-		TaskDefinition: aws.String(id),
-	})
-	return err
-}
-
-func (cmd *Remove) handleService(ctx context.Context, id string) error {
-	parts := strings.Split(id, "/")
-	_, err := cmd.ecs.DeleteServiceWithContext(ctx, &ecs.DeleteServiceInput{
-		Service: aws.String(parts[0]),
-		Cluster: aws.String(parts[1]),
-	})
-	return err
+	// Services may be given as <service>/<cluster>.
+	spec := &Spec{Type: cmd.Type, ID: cmd.ID, Cluster: cmd.Cluster}
+	if parts := strings.SplitN(cmd.ID, "/", 2); cmd.Type == "Service" && len(parts) == 2 {
+		spec.ID, spec.Cluster = parts[0], parts[1]
+	}
+	return r.Delete(ctx, spec)
 }
@@ -0,0 +1,307 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/pkg/errors"
+)
+
+// ECS is the part of the ECS API used by the resource handlers and rollouts.
+type ECS interface {
+	RegisterTaskDefinitionWithContext(ctx aws.Context, input *ecs.RegisterTaskDefinitionInput, opts ...request.Option) (*ecs.RegisterTaskDefinitionOutput, error)
+	DescribeTaskDefinitionWithContext(ctx aws.Context, input *ecs.DescribeTaskDefinitionInput, opts ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error)
+	DeregisterTaskDefinitionWithContext(ctx aws.Context, input *ecs.DeregisterTaskDefinitionInput, opts ...request.Option) (*ecs.DeregisterTaskDefinitionOutput, error)
+	ListTaskDefinitionsWithContext(ctx aws.Context, input *ecs.ListTaskDefinitionsInput, opts ...request.Option) (*ecs.ListTaskDefinitionsOutput, error)
+	DescribeServicesWithContext(ctx aws.Context, input *ecs.DescribeServicesInput, opts ...request.Option) (*ecs.DescribeServicesOutput, error)
+	CreateServiceWithContext(ctx aws.Context, input *ecs.CreateServiceInput, opts ...request.Option) (*ecs.CreateServiceOutput, error)
+	UpdateServiceWithContext(ctx aws.Context, input *ecs.UpdateServiceInput, opts ...request.Option) (*ecs.UpdateServiceOutput, error)
+	DeleteServiceWithContext(ctx aws.Context, input *ecs.DeleteServiceInput, opts ...request.Option) (*ecs.DeleteServiceOutput, error)
+	ListTasksWithContext(ctx aws.Context, input *ecs.ListTasksInput, opts ...request.Option) (*ecs.ListTasksOutput, error)
+	DescribeTasksWithContext(ctx aws.Context, input *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error)
+	TagResourceWithContext(ctx aws.Context, input *ecs.TagResourceInput, opts ...request.Option) (*ecs.TagResourceOutput, error)
+}
+
+// Resource handles one type of spec.
+type Resource interface {
+	// Input returns the value the spec payload decodes into, used to
+	// validate the spec.
+	Input() interface{}
+	Apply(ctx context.Context, spec *Spec) error
+	Delete(ctx context.Context, spec *Spec) error
+	// Get returns the live resource as a spec, nil when it does not exist.
+	Get(ctx context.Context, spec *Spec) (*Spec, error)
+	Diff(ctx context.Context, spec *Spec) ([]fieldDiff, error)
+}
+
+// resourceClients are the clients handlers are created with.
+type resourceClients struct {
+	ecs ECS
+	kv  kv.DB
+}
+
+// The resource handlers keyed by spec type.
+var resources = map[string]func(c *resourceClients) Resource{
+	"TaskDefinition": func(c *resourceClients) Resource { return &taskDefinitionResource{c.ecs} },
+	"Service":        func(c *resourceClients) Resource { return &serviceResource{c.ecs} },
+	"CronJob":        func(c *resourceClients) Resource { return &cronJobResource{c.kv} },
+}
+
+func newResource(typ string, c *resourceClients) (Resource, error) {
+	fn, ok := resources[typ]
+	if !ok {
+		return nil, errors.Errorf("Could not recognize type %s", typ)
+	}
+	return fn(c), nil
+}
+
+type taskDefinitionResource struct {
+	ecs ECS
+}
+
+func (r *taskDefinitionResource) Input() interface{} { return &ecs.RegisterTaskDefinitionInput{} }
+
+func (r *taskDefinitionResource) Apply(ctx context.Context, spec *Spec) error {
+	input := &ecs.RegisterTaskDefinitionInput{}
+	err := json.Unmarshal(spec.Spec, input)
+	if err != nil {
+		return err
+	}
+	_, err = r.ecs.RegisterTaskDefinitionWithContext(ctx, input)
+	return err
+}
+
+func (r *taskDefinitionResource) Delete(ctx context.Context, spec *Spec) error {
+	_, err := r.ecs.DeregisterTaskDefinitionWithContext(ctx, &ecs.DeregisterTaskDefinitionInput{
+		TaskDefinition: aws.String(spec.ID),
+	})
+	return err
+}
+
+func (r *taskDefinitionResource) Get(ctx context.Context, spec *Spec) (*Spec, error) {
+	out, err := r.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(r.family(spec)),
+		Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return taskDefinitionSpec(out), nil
+}
+
+func (r *taskDefinitionResource) Diff(ctx context.Context, spec *Spec) ([]fieldDiff, error) {
+	desired := &ecs.RegisterTaskDefinitionInput{}
+	err := json.Unmarshal(spec.Spec, desired)
+	if err != nil {
+		return nil, err
+	}
+	live, err := r.Get(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if live == nil {
+		return diffSpec(nil, desired)
+	}
+	return diffSpec(live.Spec, desired)
+}
+
+// family is the family the spec registers, which may differ from its id.
+func (r *taskDefinitionResource) family(spec *Spec) string {
+	input := &ecs.RegisterTaskDefinitionInput{}
+	if json.Unmarshal(spec.Spec, input) == nil && input.Family != nil {
+		return *input.Family
+	}
+	return spec.ID
+}
+
+type serviceResource struct {
+	ecs ECS
+}
+
+func (r *serviceResource) Input() interface{} { return &ecs.CreateServiceInput{} }
+
+func (r *serviceResource) Apply(ctx context.Context, spec *Spec) error {
+	cluster := serviceCluster(spec)
+	out, err := r.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+		Services: []*string{aws.String(spec.ID)},
+		Cluster:  aws.String(cluster),
+	})
+	if err != nil {
+		return err
+	}
+	if activeService(out.Services) == nil {
+		input := &ecs.CreateServiceInput{}
+		err = json.Unmarshal(spec.Spec, input)
+		if err != nil {
+			return err
+		}
+		if input.Cluster == nil && cluster != "" {
+			input.Cluster = aws.String(cluster)
+		}
+		_, err = r.ecs.CreateServiceWithContext(ctx, input)
+	} else {
+		// The spec is a create input, its serviceName has no counterpart in
+		// the update input.
+		input := &ecs.UpdateServiceInput{}
+		err = json.Unmarshal(spec.Spec, input)
+		if err != nil {
+			return err
+		}
+		input.Service = aws.String(spec.ID)
+		if input.Cluster == nil && cluster != "" {
+			input.Cluster = aws.String(cluster)
+		}
+		_, err = r.ecs.UpdateServiceWithContext(ctx, input)
+	}
+	return err
+}
+
+func (r *serviceResource) Delete(ctx context.Context, spec *Spec) error {
+	// Services must be scaled down before they can be deleted.
+	cluster := serviceCluster(spec)
+	_, err := r.ecs.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
+		Service:      aws.String(spec.ID),
+		Cluster:      aws.String(cluster),
+		DesiredCount: aws.Int64(0),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.ecs.DeleteServiceWithContext(ctx, &ecs.DeleteServiceInput{
+		Service: aws.String(spec.ID),
+		Cluster: aws.String(cluster),
+	})
+	return err
+}
+
+func (r *serviceResource) Get(ctx context.Context, spec *Spec) (*Spec, error) {
+	out, err := r.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+		Services: []*string{aws.String(spec.ID)},
+		Cluster:  aws.String(serviceCluster(spec)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	svc := activeService(out.Services)
+	if svc == nil {
+		return nil, nil
+	}
+	return serviceSpec(svc), nil
+}
+
+func (r *serviceResource) Diff(ctx context.Context, spec *Spec) ([]fieldDiff, error) {
+	desired := &ecs.CreateServiceInput{}
+	err := json.Unmarshal(spec.Spec, desired)
+	if err != nil {
+		return nil, err
+	}
+	if desired.Cluster == nil && spec.Cluster != "" {
+		desired.Cluster = aws.String(spec.Cluster)
+	}
+
+	live, err := r.Get(ctx, &Spec{ID: spec.ID, Cluster: aws.StringValue(desired.Cluster)})
+	if err != nil {
+		return nil, err
+	}
+	if live == nil {
+		return diffSpec(nil, desired)
+	}
+
+	// Resolve the task definition the service would be updated to, the spec
+	// usually names a family while the live service holds a revision ARN.
+	if desired.TaskDefinition != nil {
+		td, err := r.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: desired.TaskDefinition,
+		})
+		if err == nil {
+			desired.TaskDefinition = td.TaskDefinition.TaskDefinitionArn
+		} else if !isNotFound(err) {
+			return nil, err
+		}
+	}
+	return diffSpec(live.Spec, desired)
+}
+
+// serviceCluster returns the cluster of a service spec, the cluster in the
+// spec payload takes precedence over the top level cluster.
+func serviceCluster(spec *Spec) string {
+	input := &ecs.CreateServiceInput{}
+	if json.Unmarshal(spec.Spec, input) == nil && input.Cluster != nil {
+		return *input.Cluster
+	}
+	return spec.Cluster
+}
+
+// activeService returns the service that is not INACTIVE, deleted services
+// are still described for a while.
+func activeService(services []*ecs.Service) *ecs.Service {
+	for _, svc := range services {
+		if aws.StringValue(svc.Status) != "INACTIVE" {
+			return svc
+		}
+	}
+	return nil
+}
+
+type cronJobResource struct {
+	kv kv.DB
+}
+
+func (r *cronJobResource) Input() interface{} { return &cronJob{} }
+
+// Apply keeps the LastRun and Tasks of the stored job. The write is conditional on the
+// version read so a concurrent scheduler update is not lost.
+func (r *cronJobResource) Apply(ctx context.Context, spec *Spec) error {
+	job := &cronJob{}
+	err := json.Unmarshal(spec.Spec, job)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		live := &cronJob{}
+		version, err := r.kv.GetVersion(ctx, spec.Type, spec.ID, live)
+		if err != nil && err != kv.ErrNotFound {
+			return err
+		}
+		job.LastRun = live.LastRun
+		job.Tasks = live.Tasks
+		err = r.kv.PutVersion(ctx, spec.Type, spec.ID, job, version)
+		if err != kv.ErrConflict {
+			return err
+		}
+	}
+	return errors.New("Could not apply CronJob, it is being updated concurrently")
+}
+
+func (r *cronJobResource) Delete(ctx context.Context, spec *Spec) error {
+	return r.kv.Del(ctx, spec.Type, spec.ID)
+}
+
+func (r *cronJobResource) Get(ctx context.Context, spec *Spec) (*Spec, error) {
+	job := &cronJob{}
+	err := r.kv.Get(ctx, "CronJob", spec.ID, job)
+	if err == kv.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cronJobSpec(spec.ID, job), nil
+}
+
+func (r *cronJobResource) Diff(ctx context.Context, spec *Spec) ([]fieldDiff, error) {
+	live, err := r.Get(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if live == nil {
+		return diffSpec(nil, spec.Spec)
+	}
+	return diffSpec(live.Spec, spec.Spec)
+}
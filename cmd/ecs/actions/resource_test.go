@@ -0,0 +1,248 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/coldog/tool-ecs/internal/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+type MockECS struct {
+	mock.Mock
+}
+
+func (m *MockECS) RegisterTaskDefinitionWithContext(ctx aws.Context, input *ecs.RegisterTaskDefinitionInput, opts ...request.Option) (*ecs.RegisterTaskDefinitionOutput, error) {
+	args := m.Called(input)
+	// Registers revision 2 of the family.
+	return &ecs.RegisterTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{
+		Family:            input.Family,
+		TaskDefinitionArn: aws.String(aws.StringValue(input.Family) + ":2"),
+	}}, args.Error(0)
+}
+
+func (m *MockECS) DescribeTaskDefinitionWithContext(ctx aws.Context, input *ecs.DescribeTaskDefinitionInput, opts ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	args := m.Called(input)
+	out, _ := args.Get(0).(*ecs.DescribeTaskDefinitionOutput)
+	return out, args.Error(1)
+}
+
+func (m *MockECS) TagResourceWithContext(ctx aws.Context, input *ecs.TagResourceInput, opts ...request.Option) (*ecs.TagResourceOutput, error) {
+	args := m.Called(input)
+	return &ecs.TagResourceOutput{}, args.Error(0)
+}
+
+func (m *MockECS) DeregisterTaskDefinitionWithContext(ctx aws.Context, input *ecs.DeregisterTaskDefinitionInput, opts ...request.Option) (*ecs.DeregisterTaskDefinitionOutput, error) {
+	args := m.Called(input)
+	return &ecs.DeregisterTaskDefinitionOutput{}, args.Error(0)
+}
+
+func (m *MockECS) ListTaskDefinitionsWithContext(ctx aws.Context, input *ecs.ListTaskDefinitionsInput, opts ...request.Option) (*ecs.ListTaskDefinitionsOutput, error) {
+	args := m.Called(input)
+	out, _ := args.Get(0).(*ecs.ListTaskDefinitionsOutput)
+	return out, args.Error(1)
+}
+
+func (m *MockECS) DescribeServicesWithContext(ctx aws.Context, input *ecs.DescribeServicesInput, opts ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	args := m.Called(input)
+	out, _ := args.Get(0).(*ecs.DescribeServicesOutput)
+	return out, args.Error(1)
+}
+
+func (m *MockECS) CreateServiceWithContext(ctx aws.Context, input *ecs.CreateServiceInput, opts ...request.Option) (*ecs.CreateServiceOutput, error) {
+	args := m.Called(input)
+	return &ecs.CreateServiceOutput{}, args.Error(0)
+}
+
+func (m *MockECS) UpdateServiceWithContext(ctx aws.Context, input *ecs.UpdateServiceInput, opts ...request.Option) (*ecs.UpdateServiceOutput, error) {
+	args := m.Called(input)
+	return &ecs.UpdateServiceOutput{}, args.Error(0)
+}
+
+func (m *MockECS) DeleteServiceWithContext(ctx aws.Context, input *ecs.DeleteServiceInput, opts ...request.Option) (*ecs.DeleteServiceOutput, error) {
+	args := m.Called(input)
+	return &ecs.DeleteServiceOutput{}, args.Error(0)
+}
+
+func (m *MockECS) ListTasksWithContext(ctx aws.Context, input *ecs.ListTasksInput, opts ...request.Option) (*ecs.ListTasksOutput, error) {
+	args := m.Called(input)
+	out, _ := args.Get(0).(*ecs.ListTasksOutput)
+	return out, args.Error(1)
+}
+
+func (m *MockECS) DescribeTasksWithContext(ctx aws.Context, input *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	args := m.Called(input)
+	out, _ := args.Get(0).(*ecs.DescribeTasksOutput)
+	return out, args.Error(1)
+}
+
+func testSpec(typ, id, cluster, spec string) *Spec {
+	return &Spec{Type: typ, ID: id, Cluster: cluster, Spec: json.RawMessage(spec)}
+}
+
+func TestNewResource_Unknown(t *testing.T) {
+	_, err := newResource("Unknown", &resourceClients{})
+	assert.EqualError(t, err, "Could not recognize type Unknown")
+}
+
+func TestServiceResource_Apply(t *testing.T) {
+	m := &MockECS{}
+	r, _ := newResource("Service", &resourceClients{ecs: m})
+	spec := testSpec("Service", "web", "default", `{"serviceName": "web", "cluster": "default", "desiredCount": 2}`)
+	describe := &ecs.DescribeServicesInput{Services: []*string{aws.String("web")}, Cluster: aws.String("default")}
+
+	// Inactive services are created again.
+	m.On("DescribeServicesWithContext", describe).Return(&ecs.DescribeServicesOutput{
+		Services: []*ecs.Service{{ServiceName: aws.String("web"), Status: aws.String("INACTIVE")}},
+	}, nil).Once()
+	m.On("CreateServiceWithContext", mock.AnythingOfType("*ecs.CreateServiceInput")).Return(nil).Once()
+	assert.Nil(t, r.Apply(context.Background(), spec))
+
+	m.On("DescribeServicesWithContext", describe).Return(&ecs.DescribeServicesOutput{
+		Services: []*ecs.Service{{ServiceName: aws.String("web"), Status: aws.String("ACTIVE")}},
+	}, nil).Once()
+	m.On("UpdateServiceWithContext", &ecs.UpdateServiceInput{
+		Service:      aws.String("web"),
+		Cluster:      aws.String("default"),
+		DesiredCount: aws.Int64(2),
+	}).Return(nil).Once()
+	assert.Nil(t, r.Apply(context.Background(), spec))
+
+	m.AssertExpectations(t)
+}
+
+func TestServiceResource_ApplyCluster(t *testing.T) {
+	m := &MockECS{}
+	r, _ := newResource("Service", &resourceClients{ecs: m})
+
+	// The cluster is only set at the top level.
+	m.On("DescribeServicesWithContext", &ecs.DescribeServicesInput{Services: []*string{aws.String("web")}, Cluster: aws.String("prod")}).
+		Return(&ecs.DescribeServicesOutput{Services: []*ecs.Service{{ServiceName: aws.String("web"), Status: aws.String("ACTIVE")}}}, nil).Once()
+	m.On("UpdateServiceWithContext", &ecs.UpdateServiceInput{
+		Service:        aws.String("web"),
+		Cluster:        aws.String("prod"),
+		TaskDefinition: aws.String("web"),
+	}).Return(nil).Once()
+	assert.Nil(t, r.Apply(context.Background(), testSpec("Service", "web", "prod", `{"serviceName": "web", "taskDefinition": "web"}`)))
+
+	// The cluster in the spec takes precedence.
+	m.On("DescribeServicesWithContext", &ecs.DescribeServicesInput{Services: []*string{aws.String("web")}, Cluster: aws.String("staging")}).
+		Return(&ecs.DescribeServicesOutput{}, nil).Once()
+	m.On("CreateServiceWithContext", &ecs.CreateServiceInput{
+		ServiceName: aws.String("web"),
+		Cluster:     aws.String("staging"),
+	}).Return(nil).Once()
+	assert.Nil(t, r.Apply(context.Background(), testSpec("Service", "web", "", `{"serviceName": "web", "cluster": "staging"}`)))
+
+	m.AssertExpectations(t)
+}
+
+func TestServiceResource_Diff(t *testing.T) {
+	m := &MockECS{}
+	r, _ := newResource("Service", &resourceClients{ecs: m})
+	spec := testSpec("Service", "web", "default", `{"serviceName": "web", "taskDefinition": "web", "desiredCount": 3}`)
+
+	m.On("DescribeServicesWithContext", mock.Anything).Return(&ecs.DescribeServicesOutput{
+		Services: []*ecs.Service{{
+			ServiceName:    aws.String("web"),
+			Status:         aws.String("ACTIVE"),
+			ClusterArn:     aws.String("arn:aws:ecs:us-west-2:123:cluster/default"),
+			DesiredCount:   aws.Int64(2),
+			TaskDefinition: aws.String("arn:aws:ecs:us-west-2:123:task-definition/web:3"),
+		}},
+	}, nil)
+	m.On("DescribeTaskDefinitionWithContext", &ecs.DescribeTaskDefinitionInput{TaskDefinition: aws.String("web")}).Return(
+		&ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{
+			TaskDefinitionArn: aws.String("arn:aws:ecs:us-west-2:123:task-definition/web:3"),
+		}}, nil)
+
+	changes, err := r.Diff(context.Background(), spec)
+	assert.Nil(t, err)
+	assert.Equal(t, []fieldDiff{{Path: "desiredCount", Live: float64(2), Desired: float64(3)}}, changes)
+}
+
+func TestTaskDefinitionResource_GetMissing(t *testing.T) {
+	m := &MockECS{}
+	r, _ := newResource("TaskDefinition", &resourceClients{ecs: m})
+
+	m.On("DescribeTaskDefinitionWithContext", &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String("api"),
+		Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
+	}).Return(nil, awserr.New("ClientException", "Unable to describe task definition.", nil))
+
+	live, err := r.Get(context.Background(), testSpec("TaskDefinition", "web", "", `{"family": "api"}`))
+	assert.Nil(t, err)
+	assert.Nil(t, live)
+}
+
+func TestTaskDefinitionResource_DiffTags(t *testing.T) {
+	m := &MockECS{}
+	r, _ := newResource("TaskDefinition", &resourceClients{ecs: m})
+	spec := testSpec("TaskDefinition", "web", "", `{
+		"family": "web",
+		"containerDefinitions": [{"name": "web", "image": "web:1"}],
+		"tags": [{"key": "team", "value": "platform"}]
+	}`)
+
+	m.On("DescribeTaskDefinitionWithContext", &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String("web"),
+		Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
+	}).Return(&ecs.DescribeTaskDefinitionOutput{
+		TaskDefinition: &ecs.TaskDefinition{
+			Family:               aws.String("web"),
+			Revision:             aws.Int64(3),
+			ContainerDefinitions: []*ecs.ContainerDefinition{{Name: aws.String("web"), Image: aws.String("web:1")}},
+		},
+		Tags: []*ecs.Tag{{Key: aws.String("team"), Value: aws.String("platform")}},
+	}, nil)
+
+	changes, err := r.Diff(context.Background(), spec)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(changes))
+}
+
+func TestCronJobResource(t *testing.T) {
+	db := kv.NewLocalDB()
+	r, _ := newResource("CronJob", &resourceClients{kv: db})
+	spec := testSpec("CronJob", "nightly", "", `{"Schedule": "0 0 * * *", "TaskDefinitionID": "job"}`)
+	ctx := context.Background()
+
+	live, err := r.Get(ctx, spec)
+	assert.Nil(t, err)
+	assert.Nil(t, live)
+
+	assert.Nil(t, r.Apply(ctx, spec))
+	changes, err := r.Diff(ctx, spec)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(changes))
+
+	live, err = r.Get(ctx, spec)
+	assert.Nil(t, err)
+	assert.Equal(t, "nightly", live.ID)
+
+	assert.Nil(t, r.Delete(ctx, spec))
+	live, err = r.Get(ctx, spec)
+	assert.Nil(t, err)
+	assert.Nil(t, live)
+}
+
+func TestCronJobResource_ApplyKeepsLastRun(t *testing.T) {
+	db := kv.NewLocalDB()
+	r, _ := newResource("CronJob", &resourceClients{kv: db})
+	ctx := context.Background()
+	lastRun := time.Date(2017, 05, 05, 0, 0, 0, 0, time.UTC)
+	db.Put(ctx, "CronJob", "nightly", &cronJob{Schedule: "0 0 * * *", LastRun: lastRun})
+
+	assert.Nil(t, r.Apply(ctx, testSpec("CronJob", "nightly", "", `{"Schedule": "0 1 * * *"}`)))
+
+	job := &cronJob{}
+	db.Get(ctx, "CronJob", "nightly", job)
+	assert.Equal(t, "0 1 * * *", job.Schedule)
+	assert.Equal(t, lastRun, job.LastRun)
+}
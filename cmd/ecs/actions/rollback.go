@@ -0,0 +1,152 @@
+package actions
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Rollback struct {
+	Globals
+	Service    string
+	ToRevision int64
+	Wait       bool
+	Timeout    time.Duration
+	ecs        ECS
+}
+
+func (cmd *Rollback) ShortDescription() string { return "Roll back a service" }
+
+func (cmd *Rollback) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.Service, "service", "", "Service name")
+	fs.Int64Var(&cmd.ToRevision, "to-revision", 0, "Task definition revision to roll back to, defaults to the previous revision")
+	fs.BoolVar(&cmd.Wait, "wait", false, "Wait for the rollback to complete")
+	fs.DurationVar(&cmd.Timeout, "timeout", 10*time.Minute, "How long to wait for the rollback")
+}
+
+func (cmd *Rollback) Run(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sess, err := getSession(cmd.Globals)
+	if err != nil {
+		return errors.Wrap(err, "Could not open aws session")
+	}
+	cmd.ecs = ecs.New(sess)
+
+	svcs, err := cmd.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(cmd.Cluster),
+		Services: []*string{aws.String(cmd.Service)},
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not get services")
+	}
+	if len(svcs.Services) == 0 {
+		return errors.Errorf("Service %s not found", cmd.Service)
+	}
+	svc := svcs.Services[0]
+
+	taskDef, err := cmd.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: svc.TaskDefinition,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to describe task definition")
+	}
+	family := aws.StringValue(taskDef.TaskDefinition.Family)
+
+	var target string
+	if cmd.ToRevision > 0 {
+		target = fmt.Sprintf("%s:%d", family, cmd.ToRevision)
+	} else {
+		target, err = cmd.previousRevision(ctx, family, aws.Int64Value(taskDef.TaskDefinition.Revision))
+		if err != nil {
+			return err
+		}
+	}
+
+	r := &rollout{
+		ecs:     cmd.ecs,
+		w:       w,
+		cluster: cmd.Cluster,
+		service: cmd.Service,
+	}
+	r.skipEvents(svc)
+
+	err = rollbackService(ctx, r, aws.StringValue(svc.TaskDefinition), target)
+	if err != nil || !cmd.Wait {
+		return err
+	}
+	return r.wait(cmd.Timeout)
+}
+
+// previousRevision finds the newest active revision of the family older than
+// the current revision. The family prefix also matches other families, such
+// as web-worker for web, so the family of each ARN is compared exactly.
+func (cmd *Rollback) previousRevision(ctx context.Context, family string, current int64) (string, error) {
+	revisions := []int64{}
+	arns := map[int64]string{}
+	input := &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String(family),
+		Status:       aws.String(ecs.TaskDefinitionStatusActive),
+		Sort:         aws.String(ecs.SortOrderDesc),
+	}
+	for {
+		list, err := cmd.ecs.ListTaskDefinitionsWithContext(ctx, input)
+		if err != nil {
+			return "", errors.Wrap(err, "Could not list task definitions")
+		}
+
+		for _, arn := range list.TaskDefinitionArns {
+			if taskDefinitionFamily(aws.StringValue(arn)) != family {
+				continue
+			}
+			var revision int64
+			_, err := fmt.Sscanf(revisionSuffix(aws.StringValue(arn)), "%d", &revision)
+			if err != nil || revision >= current {
+				continue
+			}
+			revisions = append(revisions, revision)
+			arns[revision] = aws.StringValue(arn)
+		}
+
+		if aws.StringValue(list.NextToken) == "" {
+			break
+		}
+		input.NextToken = list.NextToken
+	}
+	if len(revisions) == 0 {
+		return "", errors.Errorf("No revision of %s older than %d", family, current)
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i] > revisions[j] })
+	return arns[revisions[0]], nil
+}
+
+// revisionSuffix returns the revision part of a family:revision identifier.
+func revisionSuffix(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
+
+// rollbackService points the service at the given task definition and
+// reports the change, the rollout is updated to follow the new target.
+func rollbackService(ctx context.Context, r *rollout, from, to string) error {
+	out, err := r.ecs.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
+		Cluster:        aws.String(r.cluster),
+		Service:        aws.String(r.service),
+		TaskDefinition: aws.String(to),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to roll back %s to %s", r.service, to)
+	}
+
+	r.taskDefinition = aws.StringValue(out.Service.TaskDefinition)
+	r.maxFailures = 0
+	io.WriteString(r.w, fmt.Sprintf("Rolled back %s from %s to %s\n", r.service, from, r.taskDefinition))
+	return nil
+}
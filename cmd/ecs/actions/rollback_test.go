@@ -0,0 +1,60 @@
+package actions
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func listTaskDefinitions(token string, next string, arns ...string) (*ecs.ListTaskDefinitionsInput, *ecs.ListTaskDefinitionsOutput) {
+	input := &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String("web"),
+		Status:       aws.String(ecs.TaskDefinitionStatusActive),
+		Sort:         aws.String(ecs.SortOrderDesc),
+	}
+	if token != "" {
+		input.NextToken = aws.String(token)
+	}
+	out := &ecs.ListTaskDefinitionsOutput{TaskDefinitionArns: aws.StringSlice(arns)}
+	if next != "" {
+		out.NextToken = aws.String(next)
+	}
+	return input, out
+}
+
+func TestRollback_PreviousRevision(t *testing.T) {
+	m := &MockECS{}
+	cmd := &Rollback{ecs: m}
+
+	input, out := listTaskDefinitions("", "page2",
+		"arn:aws:ecs:us-west-2:123:task-definition/web-worker:9",
+		"arn:aws:ecs:us-west-2:123:task-definition/web:5",
+	)
+	m.On("ListTaskDefinitionsWithContext", input).Return(out, nil).Once()
+	input, out = listTaskDefinitions("page2", "",
+		"arn:aws:ecs:us-west-2:123:task-definition/web-worker:4",
+		"arn:aws:ecs:us-west-2:123:task-definition/web:3",
+	)
+	m.On("ListTaskDefinitionsWithContext", input).Return(out, nil).Once()
+
+	target, err := cmd.previousRevision(context.Background(), "web", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:ecs:us-west-2:123:task-definition/web:3", target)
+	m.AssertExpectations(t)
+}
+
+func TestRollback_PreviousRevisionMissing(t *testing.T) {
+	m := &MockECS{}
+	cmd := &Rollback{ecs: m}
+
+	input, out := listTaskDefinitions("", "",
+		"arn:aws:ecs:us-west-2:123:task-definition/web-worker:2",
+		"arn:aws:ecs:us-west-2:123:task-definition/web:1",
+	)
+	m.On("ListTaskDefinitionsWithContext", input).Return(out, nil)
+
+	_, err := cmd.previousRevision(context.Background(), "web", 1)
+	assert.EqualError(t, err, "No revision of web older than 1")
+}
@@ -0,0 +1,245 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// How often a rollout is polled for progress.
+var rolloutInterval = 5 * time.Second
+
+// rollout follows a service deployment until the new task definition is
+// running at the desired count.
+type rollout struct {
+	ecs            ECS
+	w              io.Writer
+	cluster        string
+	service        string
+	taskDefinition string
+	seen           map[string]bool
+
+	// The rollout fails early once this many tasks of the new task definition
+	// have stopped, zero waits for the full timeout.
+	maxFailures int
+}
+
+// skipEvents marks the events currently on the service as seen so that only
+// events created during the rollout are streamed.
+func (r *rollout) skipEvents(svc *ecs.Service) {
+	r.seen = map[string]bool{}
+	for _, event := range svc.Events {
+		r.seen[aws.StringValue(event.Id)] = true
+	}
+}
+
+// wait polls the service until the PRIMARY deployment has reached its desired
+// count and all other deployments are drained. When the timeout expires the
+// reasons the new tasks stopped are returned in the error.
+func (r *rollout) wait(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	io.WriteString(r.w, fmt.Sprintf("Waiting for %s to roll out %s\n", r.service, r.taskDefinition))
+
+	for {
+		done, err := r.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if done {
+			io.WriteString(r.w, fmt.Sprintf("Service %s is stable\n", r.service))
+			return nil
+		}
+
+		if r.maxFailures > 0 {
+			reasons, err := r.stoppedReasons()
+			if err != nil {
+				return errors.Wrap(err, "Could not describe stopped tasks")
+			}
+			if len(reasons) >= r.maxFailures {
+				return errors.Errorf("Rollout of %s failed, %d tasks stopped:\n  %s",
+					r.service, len(reasons), strings.Join(reasons, "\n  "))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			reasons, err := r.stoppedReasons()
+			if err != nil {
+				return errors.Wrap(err, "Rollout timed out, could not describe stopped tasks")
+			}
+			if len(reasons) == 0 {
+				return errors.Errorf("Rollout of %s timed out after %s", r.service, timeout)
+			}
+			return errors.Errorf("Rollout of %s timed out after %s, stopped tasks:\n  %s",
+				r.service, timeout, strings.Join(reasons, "\n  "))
+		case <-time.After(rolloutInterval):
+		}
+	}
+}
+
+func (r *rollout) poll(ctx context.Context) (bool, error) {
+	out, err := r.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(r.cluster),
+		Services: []*string{aws.String(r.service)},
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "Could not get services")
+	}
+	if len(out.Services) == 0 {
+		return false, errors.Errorf("Service %s not found", r.service)
+	}
+	svc := out.Services[0]
+
+	r.printEvents(svc)
+
+	for _, d := range svc.Deployments {
+		io.WriteString(r.w, fmt.Sprintf("  %s %s: desired=%d running=%d pending=%d\n",
+			aws.StringValue(d.Status), aws.StringValue(d.TaskDefinition),
+			aws.Int64Value(d.DesiredCount), aws.Int64Value(d.RunningCount), aws.Int64Value(d.PendingCount)))
+	}
+
+	if len(svc.Deployments) != 1 {
+		return false, nil
+	}
+	primary := svc.Deployments[0]
+	return aws.StringValue(primary.Status) == "PRIMARY" &&
+		aws.StringValue(primary.TaskDefinition) == r.taskDefinition &&
+		aws.Int64Value(primary.RunningCount) == aws.Int64Value(primary.DesiredCount), nil
+}
+
+func (r *rollout) printEvents(svc *ecs.Service) {
+	if r.seen == nil {
+		r.seen = map[string]bool{}
+	}
+	// Events are returned newest first.
+	for i := len(svc.Events) - 1; i >= 0; i-- {
+		event := svc.Events[i]
+		if r.seen[aws.StringValue(event.Id)] {
+			continue
+		}
+		r.seen[aws.StringValue(event.Id)] = true
+		io.WriteString(r.w, fmt.Sprintf("  %s %s\n",
+			aws.TimeValue(event.CreatedAt).Format(time.RFC3339), aws.StringValue(event.Message)))
+	}
+}
+
+// stoppedReasons describes why the tasks of the new task definition stopped.
+func (r *rollout) stoppedReasons() ([]string, error) {
+	tasks, err := r.stoppedTasks()
+	if err != nil {
+		return nil, err
+	}
+	reasons := []string{}
+	for _, task := range tasks {
+		reasons = append(reasons, stoppedReason(task))
+	}
+	return reasons, nil
+}
+
+// stoppedTasks returns the stopped tasks of the new task definition.
+func (r *rollout) stoppedTasks() ([]*ecs.Task, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tasks := []*ecs.Task{}
+	input := &ecs.ListTasksInput{
+		Cluster:       aws.String(r.cluster),
+		ServiceName:   aws.String(r.service),
+		DesiredStatus: aws.String(ecs.DesiredStatusStopped),
+	}
+	for {
+		list, err := r.ecs.ListTasksWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		// A page holds at most 100 tasks, the most DescribeTasks takes.
+		if len(list.TaskArns) > 0 {
+			out, err := r.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+				Cluster: aws.String(r.cluster),
+				Tasks:   list.TaskArns,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, task := range out.Tasks {
+				if aws.StringValue(task.TaskDefinitionArn) == r.taskDefinition {
+					tasks = append(tasks, task)
+				}
+			}
+		}
+		if list.NextToken == nil {
+			return tasks, nil
+		}
+		input.NextToken = list.NextToken
+	}
+}
+
+func stoppedReason(task *ecs.Task) string {
+	reason := fmt.Sprintf("%s: %s", aws.StringValue(task.TaskArn), aws.StringValue(task.StoppedReason))
+	for _, c := range task.Containers {
+		if c.Reason == nil && c.ExitCode == nil {
+			continue
+		}
+		reason += fmt.Sprintf(" (%s: exit=%d %s)",
+			aws.StringValue(c.Name), aws.Int64Value(c.ExitCode), aws.StringValue(c.Reason))
+	}
+	return reason
+}
+
+// bake watches a stable service for the given duration and fails when its
+// tasks stop or it drops below the desired count.
+func (r *rollout) bake(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	io.WriteString(r.w, fmt.Sprintf("Baking %s for %s\n", r.service, d))
+
+	// Tasks that stopped before baking started are not counted, the list
+	// order is not stable so they are compared by ARN.
+	before, err := r.stoppedTasks()
+	if err != nil {
+		return errors.Wrap(err, "Could not describe stopped tasks")
+	}
+	seen := map[string]bool{}
+	for _, task := range before {
+		seen[aws.StringValue(task.TaskArn)] = true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(rolloutInterval):
+		}
+
+		done, err := r.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if !done && ctx.Err() == nil {
+			return errors.Errorf("Service %s is no longer stable", r.service)
+		}
+
+		tasks, err := r.stoppedTasks()
+		if err != nil {
+			return errors.Wrap(err, "Could not describe stopped tasks")
+		}
+		reasons := []string{}
+		for _, task := range tasks {
+			if !seen[aws.StringValue(task.TaskArn)] {
+				reasons = append(reasons, stoppedReason(task))
+			}
+		}
+		if len(reasons) > 0 {
+			return errors.Errorf("Tasks of %s stopped while baking:\n  %s",
+				r.service, strings.Join(reasons, "\n  "))
+		}
+	}
+}
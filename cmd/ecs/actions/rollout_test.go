@@ -0,0 +1,234 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func testRollout(m *MockECS) (*rollout, *bytes.Buffer) {
+	w := &bytes.Buffer{}
+	return &rollout{ecs: m, w: w, cluster: "default", service: "web", taskDefinition: "web:2"}, w
+}
+
+func testDeployment(status, taskDef string, desired, running int64) *ecs.Deployment {
+	return &ecs.Deployment{
+		Status:         aws.String(status),
+		TaskDefinition: aws.String(taskDef),
+		DesiredCount:   aws.Int64(desired),
+		RunningCount:   aws.Int64(running),
+		PendingCount:   aws.Int64(desired - running),
+	}
+}
+
+func describeService(deployments ...*ecs.Deployment) *ecs.DescribeServicesOutput {
+	return &ecs.DescribeServicesOutput{Services: []*ecs.Service{{Deployments: deployments}}}
+}
+
+// mockService returns the deployments whenever the service is described.
+func mockService(m *MockECS, service string, deployments ...*ecs.Deployment) *mock.Call {
+	return m.On("DescribeServicesWithContext", &ecs.DescribeServicesInput{
+		Cluster:  aws.String("default"),
+		Services: []*string{aws.String(service)},
+	}).Return(describeService(deployments...), nil)
+}
+
+// mockStoppedTasks returns the tasks whenever the stopped tasks of the
+// service are listed.
+func mockStoppedTasks(m *MockECS, service string, tasks ...*ecs.Task) *mock.Call {
+	arns := []*string{}
+	for _, task := range tasks {
+		arns = append(arns, task.TaskArn)
+	}
+	call := m.On("ListTasksWithContext", &ecs.ListTasksInput{
+		Cluster:       aws.String("default"),
+		ServiceName:   aws.String(service),
+		DesiredStatus: aws.String(ecs.DesiredStatusStopped),
+	}).Return(&ecs.ListTasksOutput{TaskArns: arns}, nil)
+	if len(tasks) > 0 {
+		m.On("DescribeTasksWithContext", &ecs.DescribeTasksInput{
+			Cluster: aws.String("default"),
+			Tasks:   arns,
+		}).Return(&ecs.DescribeTasksOutput{Tasks: tasks}, nil)
+	}
+	return call
+}
+
+func stoppedTask(arn, taskDef, reason string) *ecs.Task {
+	return &ecs.Task{TaskArn: aws.String(arn), TaskDefinitionArn: aws.String(taskDef), StoppedReason: aws.String(reason)}
+}
+
+func withRolloutInterval(d time.Duration) func() {
+	prev := rolloutInterval
+	rolloutInterval = d
+	return func() { rolloutInterval = prev }
+}
+
+func TestRollout_Poll(t *testing.T) {
+	for _, test := range []struct {
+		deployments []*ecs.Deployment
+		done        bool
+	}{
+		{[]*ecs.Deployment{testDeployment("PRIMARY", "web:2", 2, 2)}, true},
+		{[]*ecs.Deployment{testDeployment("PRIMARY", "web:2", 2, 1)}, false},
+		{[]*ecs.Deployment{testDeployment("PRIMARY", "web:1", 2, 2)}, false},
+		{[]*ecs.Deployment{testDeployment("PRIMARY", "web:2", 2, 2), testDeployment("ACTIVE", "web:1", 2, 1)}, false},
+	} {
+		m := &MockECS{}
+		r, _ := testRollout(m)
+		m.On("DescribeServicesWithContext", mock.Anything).Return(describeService(test.deployments...), nil)
+
+		done, err := r.poll(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, test.done, done)
+	}
+}
+
+func TestRollout_PollMissing(t *testing.T) {
+	m := &MockECS{}
+	r, _ := testRollout(m)
+	m.On("DescribeServicesWithContext", mock.Anything).Return(&ecs.DescribeServicesOutput{}, nil)
+
+	_, err := r.poll(context.Background())
+	assert.EqualError(t, err, "Service web not found")
+}
+
+func TestRollout_PrintEvents(t *testing.T) {
+	r, w := testRollout(&MockECS{})
+	created := time.Date(2017, 05, 05, 0, 0, 0, 0, time.UTC)
+	event := func(id, msg string) *ecs.ServiceEvent {
+		return &ecs.ServiceEvent{Id: aws.String(id), Message: aws.String(msg), CreatedAt: aws.Time(created)}
+	}
+
+	r.skipEvents(&ecs.Service{Events: []*ecs.ServiceEvent{event("1", "old")}})
+	r.printEvents(&ecs.Service{Events: []*ecs.ServiceEvent{event("3", "third"), event("2", "second"), event("1", "old")}})
+	r.printEvents(&ecs.Service{Events: []*ecs.ServiceEvent{event("3", "third"), event("2", "second")}})
+
+	assert.Equal(t, "  2017-05-05T00:00:00Z second\n  2017-05-05T00:00:00Z third\n", w.String())
+}
+
+func TestRollout_StoppedReasons(t *testing.T) {
+	m := &MockECS{}
+	r, _ := testRollout(m)
+	mockStoppedTasks(m, "web",
+		stoppedTask("task/1", "web:1", "Scaling"),
+		&ecs.Task{TaskArn: aws.String("task/2"), TaskDefinitionArn: aws.String("web:2"), StoppedReason: aws.String("Essential container exited"),
+			Containers: []*ecs.Container{{Name: aws.String("web"), ExitCode: aws.Int64(1)}, {Name: aws.String("sidecar")}}},
+	)
+
+	reasons, err := r.stoppedReasons()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"task/2: Essential container exited (web: exit=1 )"}, reasons)
+}
+
+func TestRollout_StoppedTasksPages(t *testing.T) {
+	m := &MockECS{}
+	r, _ := testRollout(m)
+	m.On("ListTasksWithContext", &ecs.ListTasksInput{
+		Cluster:       aws.String("default"),
+		ServiceName:   aws.String("web"),
+		DesiredStatus: aws.String(ecs.DesiredStatusStopped),
+	}).Return(&ecs.ListTasksOutput{TaskArns: aws.StringSlice([]string{"task/1"}), NextToken: aws.String("next")}, nil).Once()
+	m.On("ListTasksWithContext", &ecs.ListTasksInput{
+		Cluster:       aws.String("default"),
+		ServiceName:   aws.String("web"),
+		DesiredStatus: aws.String(ecs.DesiredStatusStopped),
+		NextToken:     aws.String("next"),
+	}).Return(&ecs.ListTasksOutput{TaskArns: aws.StringSlice([]string{"task/2"})}, nil).Once()
+	m.On("DescribeTasksWithContext", &ecs.DescribeTasksInput{Cluster: aws.String("default"), Tasks: aws.StringSlice([]string{"task/1"})}).
+		Return(&ecs.DescribeTasksOutput{Tasks: []*ecs.Task{stoppedTask("task/1", "web:2", "Scaling")}}, nil)
+	m.On("DescribeTasksWithContext", &ecs.DescribeTasksInput{Cluster: aws.String("default"), Tasks: aws.StringSlice([]string{"task/2"})}).
+		Return(&ecs.DescribeTasksOutput{Tasks: []*ecs.Task{stoppedTask("task/2", "web:2", "Essential container exited")}}, nil)
+
+	reasons, err := r.stoppedReasons()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"task/1: Scaling", "task/2: Essential container exited"}, reasons)
+	m.AssertExpectations(t)
+}
+
+func TestRollout_Wait(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	r, w := testRollout(m)
+	m.On("DescribeServicesWithContext", mock.Anything).Return(describeService(
+		testDeployment("PRIMARY", "web:2", 2, 1), testDeployment("ACTIVE", "web:1", 1, 1),
+	), nil).Once()
+	m.On("DescribeServicesWithContext", mock.Anything).Return(describeService(
+		testDeployment("PRIMARY", "web:2", 2, 2),
+	), nil).Once()
+
+	assert.Nil(t, r.wait(time.Second))
+	assert.Contains(t, w.String(), "PRIMARY web:2: desired=2 running=1 pending=1")
+	assert.Contains(t, w.String(), "Service web is stable")
+	m.AssertExpectations(t)
+}
+
+func TestRollout_WaitMaxFailures(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	r, _ := testRollout(m)
+	r.maxFailures = 1
+	m.On("DescribeServicesWithContext", mock.Anything).Return(describeService(
+		testDeployment("PRIMARY", "web:2", 2, 0), testDeployment("ACTIVE", "web:1", 2, 2),
+	), nil)
+	mockStoppedTasks(m, "web", stoppedTask("task/2", "web:2", "OOM"))
+
+	err := r.wait(time.Second)
+	assert.EqualError(t, err, "Rollout of web failed, 1 tasks stopped:\n  task/2: OOM")
+}
+
+func TestRollout_WaitTimeout(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	r, _ := testRollout(m)
+	m.On("DescribeServicesWithContext", mock.Anything).Return(describeService(
+		testDeployment("PRIMARY", "web:2", 2, 1),
+	), nil)
+	mockStoppedTasks(m, "web")
+
+	err := r.wait(20 * time.Millisecond)
+	assert.EqualError(t, err, "Rollout of web timed out after 20ms")
+}
+
+func TestRollout_Bake(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	r, w := testRollout(m)
+	mockService(m, "web", testDeployment("PRIMARY", "web:2", 2, 2))
+
+	// Tasks stopped before baking are ignored even when listed in another order.
+	mockStoppedTasks(m, "web", stoppedTask("task/1", "web:2", "OOM"), stoppedTask("task/2", "web:2", "OOM")).Once()
+	mockStoppedTasks(m, "web", stoppedTask("task/2", "web:2", "OOM"), stoppedTask("task/1", "web:2", "OOM"))
+
+	assert.Nil(t, r.bake(20*time.Millisecond))
+	assert.Contains(t, w.String(), "Baking web for 20ms")
+}
+
+func TestRollout_BakeStoppedTask(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	r, _ := testRollout(m)
+	mockService(m, "web", testDeployment("PRIMARY", "web:2", 2, 2))
+
+	mockStoppedTasks(m, "web", stoppedTask("task/1", "web:2", "OOM")).Once()
+	mockStoppedTasks(m, "web", stoppedTask("task/3", "web:2", "Health check failed"), stoppedTask("task/1", "web:2", "OOM"))
+
+	err := r.bake(time.Second)
+	assert.EqualError(t, err, "Tasks of web stopped while baking:\n  task/3: Health check failed")
+}
+
+func TestRollout_BakeUnstable(t *testing.T) {
+	defer withRolloutInterval(time.Millisecond)()
+	m := &MockECS{}
+	r, _ := testRollout(m)
+	mockService(m, "web", testDeployment("PRIMARY", "web:2", 2, 1))
+	mockStoppedTasks(m, "web")
+
+	err := r.bake(time.Second)
+	assert.EqualError(t, err, "Service web is no longer stable")
+}
@@ -0,0 +1,234 @@
+package actions
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ExitError is returned when a command should exit with a specific code, such
+// as the exit code of a task.
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (err *ExitError) Error() string { return err.Message }
+
+type Run struct {
+	Globals
+	TaskDefinition string
+	Container      string
+	Command        string
+	Env            stringList
+	Wait           bool
+	Timeout        time.Duration
+	ecs            *ecs.ECS
+	logs           CloudWatchLogs
+}
+
+func (cmd *Run) ShortDescription() string { return "Run a one-off task" }
+
+func (cmd *Run) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.TaskDefinition, "task-definition", "", "Task definition family or family:revision")
+	fs.StringVar(&cmd.Container, "container", "", "Container the overrides apply to, defaults to the first essential container")
+	fs.StringVar(&cmd.Command, "command", "", `Override the command, written as ["command", "args"]`)
+	fs.Var(&cmd.Env, "env", "Set an environment variable as KEY=VAL, may be repeated")
+	fs.BoolVar(&cmd.Wait, "wait", false, "Wait for the task to stop, print its logs and exit with its exit code")
+	fs.DurationVar(&cmd.Timeout, "timeout", 30*time.Minute, "How long to wait for the task")
+}
+
+func (cmd *Run) Run(w io.Writer) error {
+	if cmd.TaskDefinition == "" {
+		return errors.New("Run requires a task definition")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sess, err := getSession(cmd.Globals)
+	if err != nil {
+		return errors.Wrap(err, "Could not open aws session")
+	}
+	cmd.ecs = ecs.New(sess)
+	cmd.logs = cloudwatchlogs.New(sess)
+
+	out, err := cmd.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(cmd.TaskDefinition),
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to describe task definition")
+	}
+	taskDef := out.TaskDefinition
+
+	overrides, err := runOverrides(taskDef, cmd.Container, cmd.Command, cmd.Env)
+	if err != nil {
+		return err
+	}
+
+	run, err := cmd.ecs.RunTaskWithContext(ctx, &ecs.RunTaskInput{
+		Cluster:        aws.String(cmd.Cluster),
+		TaskDefinition: taskDef.TaskDefinitionArn,
+		StartedBy:      aws.String("ecs-run"),
+		Overrides:      overrides,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not run task")
+	}
+	task, err := startedTask(run)
+	if err != nil {
+		return err
+	}
+	taskID := shortName(aws.StringValue(task.TaskArn))
+	io.WriteString(w, fmt.Sprintf("Started task %s\n", taskID))
+
+	if !cmd.Wait {
+		return nil
+	}
+
+	sources, err := logSources(taskDef, []string{taskID}, "")
+	if err != nil {
+		io.WriteString(w, fmt.Sprintf("Not printing logs: %s\n", err))
+	}
+	tail := &logTail{client: cmd.logs, start: time.Now().Add(-time.Minute), seen: map[string]int64{}}
+
+	task, err = cmd.wait(w, task, tail, sources)
+	if err != nil {
+		return err
+	}
+	// Logs arrive in CloudWatch shortly after the task stops.
+	if sources != nil {
+		time.Sleep(logsInterval)
+		tail.print(w, sources)
+	}
+
+	code, err := exitCode(taskDef, task)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return &ExitError{Code: code, Message: fmt.Sprintf("Task %s exited with code %d", taskID, code)}
+	}
+	io.WriteString(w, fmt.Sprintf("Task %s exited with code 0\n", taskID))
+	return nil
+}
+
+// wait polls the task until it stops, printing its logs as they arrive.
+func (cmd *Run) wait(w io.Writer, task *ecs.Task, tail *logTail, sources []*logSource) (*ecs.Task, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.Timeout)
+	defer cancel()
+
+	for {
+		if sources != nil {
+			err := tail.print(w, sources)
+			if err != nil {
+				io.WriteString(w, fmt.Sprintf("Could not print logs: %s\n", err))
+			}
+		}
+
+		out, err := cmd.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(cmd.Cluster),
+			Tasks:   []*string{task.TaskArn},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not describe tasks")
+		}
+		if len(out.Tasks) > 0 {
+			task = out.Tasks[0]
+			if aws.StringValue(task.LastStatus) == ecs.DesiredStatusStopped {
+				return task, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Errorf("Timed out waiting for task %s", shortName(aws.StringValue(task.TaskArn)))
+		case <-time.After(rolloutInterval):
+		}
+	}
+}
+
+// startedTask returns the task RunTask started.
+func startedTask(run *ecs.RunTaskOutput) (*ecs.Task, error) {
+	if len(run.Failures) > 0 {
+		return nil, errors.Errorf("Could not run task: %s", aws.StringValue(run.Failures[0].Reason))
+	}
+	if len(run.Tasks) == 0 {
+		return nil, errors.New("Could not run task: no task was started")
+	}
+	return run.Tasks[0], nil
+}
+
+// runOverrides builds the overrides for the container, the first essential
+// container when no name is given.
+func runOverrides(taskDef *ecs.TaskDefinition, container, command string, env []string) (*ecs.TaskOverride, error) {
+	if command == "" && len(env) == 0 {
+		return nil, nil
+	}
+	if container == "" {
+		for _, c := range taskDef.ContainerDefinitions {
+			if c.Essential == nil || *c.Essential {
+				container = aws.StringValue(c.Name)
+				break
+			}
+		}
+	}
+
+	found := false
+	for _, c := range taskDef.ContainerDefinitions {
+		found = found || aws.StringValue(c.Name) == container
+	}
+	if !found {
+		return nil, errors.Errorf("Container %s not found in task definition", container)
+	}
+
+	override := &ecs.ContainerOverride{Name: aws.String(container)}
+	if command != "" {
+		args, err := parseCommand(command)
+		if err != nil {
+			return nil, err
+		}
+		override.Command = aws.StringSlice(args)
+	}
+	for _, pair := range env {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("Environment variable %s must be KEY=VAL", pair)
+		}
+		override.Environment = setEnv(override.Environment, parts[0], parts[1])
+	}
+	return &ecs.TaskOverride{ContainerOverrides: []*ecs.ContainerOverride{override}}, nil
+}
+
+// exitCode returns the first non zero exit code of the essential containers
+// of a stopped task.
+func exitCode(taskDef *ecs.TaskDefinition, task *ecs.Task) (int, error) {
+	essential := map[string]bool{}
+	for _, c := range taskDef.ContainerDefinitions {
+		essential[aws.StringValue(c.Name)] = c.Essential == nil || *c.Essential
+	}
+
+	for _, c := range task.Containers {
+		if !essential[aws.StringValue(c.Name)] {
+			continue
+		}
+		if c.ExitCode == nil {
+			reason := aws.StringValue(c.Reason)
+			if reason == "" {
+				reason = aws.StringValue(task.StoppedReason)
+			}
+			return 0, errors.Errorf("Container %s did not exit: %s", aws.StringValue(c.Name), reason)
+		}
+		if code := int(*c.ExitCode); code != 0 {
+			return code, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,74 @@
+package actions
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func runTaskDefinition() *ecs.TaskDefinition {
+	return &ecs.TaskDefinition{ContainerDefinitions: []*ecs.ContainerDefinition{
+		{Name: aws.String("sidecar"), Essential: aws.Bool(false)},
+		{Name: aws.String("app"), Essential: aws.Bool(true)},
+	}}
+}
+
+func TestRunOverrides(t *testing.T) {
+	taskDef := runTaskDefinition()
+
+	overrides, err := runOverrides(taskDef, "", "", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, overrides)
+
+	overrides, err = runOverrides(taskDef, "", `["sh", "-c", "rake db:migrate && rake db:seed"]`, []string{"A=1", "B=x=y"})
+	assert.Nil(t, err)
+	override := overrides.ContainerOverrides[0]
+	assert.Equal(t, "app", aws.StringValue(override.Name))
+	assert.Equal(t, []string{"sh", "-c", "rake db:migrate && rake db:seed"}, aws.StringValueSlice(override.Command))
+	assert.Equal(t, "x=y", aws.StringValue(override.Environment[1].Value))
+
+	_, err = runOverrides(taskDef, "", "", []string{"A"})
+	assert.EqualError(t, err, "Environment variable A must be KEY=VAL")
+
+	_, err = runOverrides(taskDef, "", "rake db:migrate", nil)
+	assert.NotNil(t, err)
+
+	_, err = runOverrides(taskDef, "db", `["true"]`, nil)
+	assert.EqualError(t, err, "Container db not found in task definition")
+}
+
+func TestStartedTask(t *testing.T) {
+	task, err := startedTask(&ecs.RunTaskOutput{Tasks: []*ecs.Task{{TaskArn: aws.String("task/1")}}})
+	assert.Nil(t, err)
+	assert.Equal(t, "task/1", aws.StringValue(task.TaskArn))
+
+	_, err = startedTask(&ecs.RunTaskOutput{Failures: []*ecs.Failure{{Reason: aws.String("RESOURCE:MEMORY")}}})
+	assert.EqualError(t, err, "Could not run task: RESOURCE:MEMORY")
+
+	_, err = startedTask(&ecs.RunTaskOutput{})
+	assert.EqualError(t, err, "Could not run task: no task was started")
+}
+
+func TestExitCode(t *testing.T) {
+	taskDef := runTaskDefinition()
+
+	code, err := exitCode(taskDef, &ecs.Task{Containers: []*ecs.Container{
+		{Name: aws.String("sidecar"), ExitCode: aws.Int64(137)},
+		{Name: aws.String("app"), ExitCode: aws.Int64(0)},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, code)
+
+	code, err = exitCode(taskDef, &ecs.Task{Containers: []*ecs.Container{
+		{Name: aws.String("app"), ExitCode: aws.Int64(2)},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, code)
+
+	_, err = exitCode(taskDef, &ecs.Task{
+		StoppedReason: aws.String("CannotPullContainerError"),
+		Containers:    []*ecs.Container{{Name: aws.String("app")}},
+	})
+	assert.EqualError(t, err, "Container app did not exit: CannotPullContainerError")
+}
@@ -0,0 +1,168 @@
+package actions
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Spec is a single resource document as written in the resource yaml files.
+type Spec struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Cluster string          `json:"cluster"`
+	Spec    json.RawMessage `json:"spec"`
+
+	// Labels select the spec with apply -selector.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// The file and line this spec was read from.
+	File string `json:"-"`
+	Line int    `json:"-"`
+
+	// The yaml document of this spec.
+	doc []byte
+}
+
+// The order resources are applied in, resources referenced by others come first.
+var specOrder = map[string]int{
+	"TaskDefinition": 0,
+	"Service":        1,
+	"CronJob":        2,
+}
+
+func (spec *Spec) String() string { return spec.Type + "/" + spec.ID }
+
+// readSpecs reads every spec found at the path. Directories are walked
+// recursively and every yaml file may contain multiple documents separated by
+// "---". Variables are expanded before decoding. The specs are returned in
+// dependency order.
+func readSpecs(path string, vars map[string]string) ([]*Spec, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not open file")
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = findSpecFiles(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	specs := []*Spec{}
+	for _, file := range files {
+		fileSpecs, err := readSpecFile(file, vars)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, fileSpecs...)
+	}
+
+	sortSpecs(specs)
+	return specs, nil
+}
+
+func findSpecFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if !info.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read directory")
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func readSpecFile(file string, vars map[string]string) ([]*Spec, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read file")
+	}
+	data, err = expandVars(data, vars)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not render file %s", file)
+	}
+
+	specs := []*Spec{}
+	docs, err := splitDocuments(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read %s", file)
+	}
+	for _, doc := range docs {
+		if len(bytes.TrimSpace(doc.data)) == 0 {
+			continue
+		}
+		spec := &Spec{File: file, Line: doc.line, doc: doc.data}
+		err = yaml.Unmarshal(doc.data, spec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not decode %s:%d", file, doc.line)
+		}
+		if spec.Type == "" && spec.ID == "" && len(spec.Spec) == 0 {
+			// Only comments in this document.
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+type document struct {
+	data []byte
+	line int
+}
+
+// splitDocuments splits a yaml stream on "---" document separators, each
+// document keeps the line number it starts on.
+func splitDocuments(data []byte) ([]document, error) {
+	docs := []document{}
+	current := document{line: 1}
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// No line is longer than the whole stream.
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if strings.HasPrefix(line, "---") && strings.TrimSpace(line[3:]) == "" {
+			docs = append(docs, current)
+			current = document{line: n + 1}
+			continue
+		}
+		current.data = append(current.data, line...)
+		current.data = append(current.data, '\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Could not split documents")
+	}
+	return append(docs, current), nil
+}
+
+func sortSpecs(specs []*Spec) {
+	sort.SliceStable(specs, func(i, j int) bool {
+		return specRank(specs[i]) < specRank(specs[j])
+	})
+}
+
+func specRank(spec *Spec) int {
+	if rank, ok := specOrder[spec.Type]; ok {
+		return rank
+	}
+	return len(specOrder)
+}
@@ -0,0 +1,63 @@
+package actions
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSpecs_Directory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "specs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "services"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "services", "web.yml"), []byte(`
+type: Service
+id: web
+spec:
+  serviceName: web
+---
+# comments only
+---
+type: CronJob
+id: cleanup
+spec:
+  Schedule: "0 * * * *"
+`), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "web_task.yaml"), []byte(`
+type: TaskDefinition
+id: web
+spec:
+  family: web
+`), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "readme.md"), []byte("not a spec"), 0600)
+
+	specs, err := readSpecs(dir, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(specs))
+	assert.Equal(t, "TaskDefinition/web", specs[0].String())
+	assert.Equal(t, "Service/web", specs[1].String())
+	assert.Equal(t, "CronJob/cleanup", specs[2].String())
+	assert.Equal(t, filepath.Join(dir, "services", "web.yml"), specs[1].File)
+	assert.Equal(t, 9, specs[2].Line)
+}
+
+func TestSplitDocuments(t *testing.T) {
+	docs, err := splitDocuments([]byte("a: 1\n---\nb: 2\n--- \nc: 3\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(docs))
+	assert.Equal(t, "b: 2\n", string(docs[1].data))
+	assert.Equal(t, 3, docs[1].line)
+}
+
+func TestSplitDocuments_LongLine(t *testing.T) {
+	long := "a: " + strings.Repeat("x", 100*1024) + "\n"
+	docs, err := splitDocuments([]byte(long + "---\nb: 2\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(docs))
+	assert.Equal(t, long, string(docs[0].data))
+}
@@ -0,0 +1,266 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Clears the terminal and moves the cursor home before each refresh.
+const clearScreen = "\033[H\033[2J"
+
+type Status struct {
+	Globals
+	Watch    bool
+	Interval time.Duration
+	Events   int
+	ecs      *ecs.ECS
+}
+
+func (cmd *Status) ShortDescription() string { return "Show an overview of a cluster" }
+
+func (cmd *Status) Flags(fs *flag.FlagSet) {
+	fs.BoolVar(&cmd.Watch, "watch", false, "Keep refreshing the overview")
+	fs.DurationVar(&cmd.Interval, "interval", 5*time.Second, "How often to refresh with -watch")
+	fs.IntVar(&cmd.Events, "events", 10, "Number of recent service events to show")
+}
+
+func (cmd *Status) Run(w io.Writer) error {
+	sess, err := getSession(cmd.Globals)
+	if err != nil {
+		return errors.Wrap(err, "Could not open aws session")
+	}
+	cmd.ecs = ecs.New(sess)
+
+	for {
+		status, err := cmd.fetch()
+		if err != nil {
+			return err
+		}
+
+		// Render fully before clearing so the screen does not flicker.
+		buf := &bytes.Buffer{}
+		err = status.render(buf, cmd.Events)
+		if err != nil {
+			return err
+		}
+		if cmd.Watch {
+			io.WriteString(w, clearScreen)
+		}
+		w.Write(buf.Bytes())
+
+		if !cmd.Watch {
+			return nil
+		}
+		time.Sleep(cmd.Interval)
+	}
+}
+
+// clusterStatus is a snapshot of the resources of a cluster.
+type clusterStatus struct {
+	cluster   string
+	updated   time.Time
+	instances []*ecs.ContainerInstance
+	services  []*ecs.Service
+	tasks     []*ecs.Task
+}
+
+func (cmd *Status) fetch() (*clusterStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	status := &clusterStatus{cluster: cmd.Cluster, updated: time.Now()}
+	cluster := aws.String(cmd.Cluster)
+
+	arns := []*string{}
+	err := cmd.ecs.ListContainerInstancesPagesWithContext(ctx, &ecs.ListContainerInstancesInput{Cluster: cluster},
+		func(out *ecs.ListContainerInstancesOutput, last bool) bool {
+			arns = append(arns, out.ContainerInstanceArns...)
+			return true
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list container instances")
+	}
+	for _, batch := range batches(arns, 100) {
+		out, err := cmd.ecs.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+			Cluster:            cluster,
+			ContainerInstances: batch,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get container instances")
+		}
+		status.instances = append(status.instances, out.ContainerInstances...)
+	}
+
+	arns = []*string{}
+	err = cmd.ecs.ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{Cluster: cluster},
+		func(out *ecs.ListServicesOutput, last bool) bool {
+			arns = append(arns, out.ServiceArns...)
+			return true
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list services")
+	}
+	for _, batch := range batches(arns, 10) {
+		out, err := cmd.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+			Cluster:  cluster,
+			Services: batch,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get services")
+		}
+		status.services = append(status.services, out.Services...)
+	}
+
+	arns = []*string{}
+	err = cmd.ecs.ListTasksPagesWithContext(ctx, &ecs.ListTasksInput{Cluster: cluster},
+		func(out *ecs.ListTasksOutput, last bool) bool {
+			arns = append(arns, out.TaskArns...)
+			return true
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list tasks")
+	}
+	for _, batch := range batches(arns, 100) {
+		out, err := cmd.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: cluster,
+			Tasks:   batch,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get tasks")
+		}
+		status.tasks = append(status.tasks, out.Tasks...)
+	}
+	return status, nil
+}
+
+func (status *clusterStatus) render(w io.Writer, events int) error {
+	io.WriteString(w, fmt.Sprintf("Cluster %s, updated %s\n", status.cluster, status.updated.Local().Format("15:04:05")))
+
+	// Tasks placed on each instance, counted by task definition.
+	placed := map[string]map[string]int{}
+	pending := &resourceList{header: []string{"ID", "TASK DEFINITION", "INSTANCE", "CREATED"}}
+	for _, task := range status.tasks {
+		inst := aws.StringValue(task.ContainerInstanceArn)
+		if placed[inst] == nil {
+			placed[inst] = map[string]int{}
+		}
+		placed[inst][shortName(aws.StringValue(task.TaskDefinitionArn))]++
+
+		if aws.StringValue(task.LastStatus) == "PENDING" {
+			pending.add(task,
+				shortName(aws.StringValue(task.TaskArn)),
+				shortName(aws.StringValue(task.TaskDefinitionArn)),
+				shortName(inst),
+				formatTime(task.CreatedAt),
+			)
+		}
+	}
+
+	instances := &resourceList{header: []string{"INSTANCE", "EC2 INSTANCE", "AGENT", "CPU", "MEMORY", "TASKS"}}
+	for _, inst := range status.instances {
+		agent := "disconnected"
+		if aws.BoolValue(inst.AgentConnected) {
+			agent = "connected"
+		}
+		instances.add(inst,
+			shortName(aws.StringValue(inst.ContainerInstanceArn)),
+			aws.StringValue(inst.Ec2InstanceId),
+			agent,
+			formatUsagePercent(inst, "CPU"),
+			formatUsagePercent(inst, "MEMORY"),
+			formatPlacement(placed[aws.StringValue(inst.ContainerInstanceArn)]),
+		)
+	}
+
+	services := &resourceList{header: []string{"SERVICE", "DESIRED", "RUNNING", "PENDING", "TASK DEFINITION"}}
+	recent := []*serviceEvent{}
+	for _, svc := range status.services {
+		for _, e := range svc.Events {
+			recent = append(recent, &serviceEvent{aws.StringValue(svc.ServiceName), e})
+		}
+		if aws.Int64Value(svc.RunningCount) == aws.Int64Value(svc.DesiredCount) {
+			continue
+		}
+		services.add(svc,
+			aws.StringValue(svc.ServiceName),
+			fmt.Sprint(aws.Int64Value(svc.DesiredCount)),
+			fmt.Sprint(aws.Int64Value(svc.RunningCount)),
+			fmt.Sprint(aws.Int64Value(svc.PendingCount)),
+			shortName(aws.StringValue(svc.TaskDefinition)),
+		)
+	}
+
+	sort.Slice(recent, func(i, j int) bool {
+		return aws.TimeValue(recent[i].event.CreatedAt).After(aws.TimeValue(recent[j].event.CreatedAt))
+	})
+	if len(recent) > events {
+		recent = recent[:events]
+	}
+	eventList := &resourceList{header: []string{"TIME", "SERVICE", "MESSAGE"}}
+	for _, e := range recent {
+		eventList.add(e, formatTime(e.event.CreatedAt), e.service, aws.StringValue(e.event.Message))
+	}
+
+	sections := []struct {
+		title string
+		list  *resourceList
+	}{
+		{"Instances", instances},
+		{"Services not at desired count", services},
+		{"Pending tasks", pending},
+		{"Recent events", eventList},
+	}
+	for _, section := range sections {
+		io.WriteString(w, fmt.Sprintf("\n%s (%d)\n", section.title, len(section.list.rows)))
+		if len(section.list.rows) == 0 {
+			continue
+		}
+		err := section.list.write(w, "table", false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type serviceEvent struct {
+	service string
+	event   *ecs.ServiceEvent
+}
+
+// formatUsagePercent shows the reserved and registered amount of a resource
+// with the percentage reserved.
+func formatUsagePercent(inst *ecs.ContainerInstance, name string) string {
+	registered := resourceValue(inst.RegisteredResources, name)
+	if registered == 0 {
+		return formatUsage(inst, name)
+	}
+	reserved := registered - resourceValue(inst.RemainingResources, name)
+	return fmt.Sprintf("%s (%d%%)", formatUsage(inst, name), reserved*100/registered)
+}
+
+// formatPlacement lists the task definitions placed on an instance.
+func formatPlacement(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+	names := []string{}
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := []string{}
+	for _, name := range names {
+		out = append(out, fmt.Sprintf("%s x%d", name, counts[name]))
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,70 @@
+package actions
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestClusterStatus_Render(t *testing.T) {
+	now := time.Date(2017, 5, 5, 12, 0, 0, 0, time.UTC)
+	instanceArn := "arn:aws:ecs:us-west-2:123:container-instance/i1"
+	status := &clusterStatus{
+		cluster: "default",
+		updated: now,
+		instances: []*ecs.ContainerInstance{{
+			ContainerInstanceArn: aws.String(instanceArn),
+			Ec2InstanceId:        aws.String("i-123"),
+			AgentConnected:       aws.Bool(true),
+			RegisteredResources: []*ecs.Resource{
+				{Name: aws.String("CPU"), IntegerValue: aws.Int64(1024)},
+				{Name: aws.String("MEMORY"), IntegerValue: aws.Int64(2000)},
+			},
+			RemainingResources: []*ecs.Resource{
+				{Name: aws.String("CPU"), IntegerValue: aws.Int64(256)},
+				{Name: aws.String("MEMORY"), IntegerValue: aws.Int64(1000)},
+			},
+		}},
+		services: []*ecs.Service{
+			{
+				ServiceName:    aws.String("web"),
+				DesiredCount:   aws.Int64(2),
+				RunningCount:   aws.Int64(2),
+				TaskDefinition: aws.String("arn:aws:ecs:us-west-2:123:task-definition/web:3"),
+				Events: []*ecs.ServiceEvent{
+					{CreatedAt: aws.Time(now.Add(-time.Hour)), Message: aws.String("old event")},
+					{CreatedAt: aws.Time(now), Message: aws.String("new event")},
+				},
+			},
+			{
+				ServiceName:    aws.String("worker"),
+				DesiredCount:   aws.Int64(3),
+				RunningCount:   aws.Int64(1),
+				PendingCount:   aws.Int64(1),
+				TaskDefinition: aws.String("arn:aws:ecs:us-west-2:123:task-definition/worker:1"),
+			},
+		},
+		tasks: []*ecs.Task{
+			{TaskArn: aws.String("arn:task/t1"), TaskDefinitionArn: aws.String("arn:task-definition/web:3"), ContainerInstanceArn: aws.String(instanceArn), LastStatus: aws.String("RUNNING")},
+			{TaskArn: aws.String("arn:task/t2"), TaskDefinitionArn: aws.String("arn:task-definition/web:3"), ContainerInstanceArn: aws.String(instanceArn), LastStatus: aws.String("RUNNING")},
+			{TaskArn: aws.String("arn:task/t3"), TaskDefinitionArn: aws.String("arn:task-definition/worker:1"), ContainerInstanceArn: aws.String(instanceArn), LastStatus: aws.String("PENDING")},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, status.render(buf, 1))
+	out := buf.String()
+
+	assert.Contains(t, out, "768/1024 (75%)")
+	assert.Contains(t, out, "1000/2000 (50%)")
+	assert.Contains(t, out, "web:3 x2, worker:1 x1")
+	assert.Contains(t, out, "Services not at desired count (1)")
+	assert.Regexp(t, `worker\s+3\s+1\s+1\s+worker:1`, out)
+	assert.Contains(t, out, "Pending tasks (1)")
+	assert.Regexp(t, `t3\s+worker:1\s+i1`, out)
+	assert.Contains(t, out, "new event")
+	assert.NotContains(t, out, "old event")
+}
@@ -0,0 +1,167 @@
+package actions
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// cloneTaskDefinition builds a register input from a described task
+// definition.
+func cloneTaskDefinition(out *ecs.DescribeTaskDefinitionOutput) *ecs.RegisterTaskDefinitionInput {
+	taskDef := out.TaskDefinition
+	input := &ecs.RegisterTaskDefinitionInput{
+		ContainerDefinitions:    taskDef.ContainerDefinitions,
+		Cpu:                     taskDef.Cpu,
+		ExecutionRoleArn:        taskDef.ExecutionRoleArn,
+		Family:                  taskDef.Family,
+		IpcMode:                 taskDef.IpcMode,
+		Memory:                  taskDef.Memory,
+		NetworkMode:             taskDef.NetworkMode,
+		PidMode:                 taskDef.PidMode,
+		PlacementConstraints:    taskDef.PlacementConstraints,
+		ProxyConfiguration:      taskDef.ProxyConfiguration,
+		RequiresCompatibilities: taskDef.RequiresCompatibilities,
+		TaskRoleArn:             taskDef.TaskRoleArn,
+		Volumes:                 taskDef.Volumes,
+	}
+	if len(out.Tags) > 0 {
+		input.Tags = out.Tags
+	}
+	return input
+}
+
+// containerPatch holds changes to container definitions, every entry is
+// written as <container>:<value>.
+type containerPatch struct {
+	Env      stringList // <container>:KEY=VAL
+	UnsetEnv stringList // <container>:KEY
+	Cpu      stringList // <container>:units
+	Memory   stringList // <container>:MiB
+	Command  stringList // <container>:["command", "args"]
+	Secret   stringList // <container>:KEY=parameter ARN
+}
+
+func (p *containerPatch) apply(input *ecs.RegisterTaskDefinitionInput) error {
+	containers := map[string]*ecs.ContainerDefinition{}
+	for _, c := range input.ContainerDefinitions {
+		containers[aws.StringValue(c.Name)] = c
+	}
+
+	each := func(args stringList, fn func(c *ecs.ContainerDefinition, value string) error) error {
+		for _, arg := range args {
+			parts := strings.SplitN(arg, ":", 2)
+			if len(parts) != 2 {
+				return errors.Errorf("Container changes must be described as <name>:<value>, received: %s", arg)
+			}
+			c, ok := containers[parts[0]]
+			if !ok {
+				return errors.Errorf("Container %s not found in task definition", parts[0])
+			}
+			if err := fn(c, parts[1]); err != nil {
+				return errors.Wrapf(err, "Invalid value %s", arg)
+			}
+		}
+		return nil
+	}
+
+	err := each(p.Env, func(c *ecs.ContainerDefinition, value string) error {
+		pair := strings.SplitN(value, "=", 2)
+		if len(pair) != 2 {
+			return errors.New("environment must be KEY=VAL")
+		}
+		c.Environment = setEnv(c.Environment, pair[0], pair[1])
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = each(p.UnsetEnv, func(c *ecs.ContainerDefinition, value string) error {
+		c.Environment = unsetEnv(c.Environment, value)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = each(p.Cpu, func(c *ecs.ContainerDefinition, value string) error {
+		cpu, err := strconv.ParseInt(value, 10, 64)
+		c.Cpu = aws.Int64(cpu)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = each(p.Memory, func(c *ecs.ContainerDefinition, value string) error {
+		memory, err := strconv.ParseInt(value, 10, 64)
+		c.Memory = aws.Int64(memory)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = each(p.Command, func(c *ecs.ContainerDefinition, value string) error {
+		command, err := parseCommand(value)
+		c.Command = aws.StringSlice(command)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return each(p.Secret, func(c *ecs.ContainerDefinition, value string) error {
+		pair := strings.SplitN(value, "=", 2)
+		if len(pair) != 2 || pair[1] == "" {
+			return errors.New("secret must be KEY=ARN")
+		}
+		c.Secrets = setSecret(c.Secrets, pair[0], pair[1])
+		return nil
+	})
+}
+
+// parseCommand parses a command written as a JSON array, the same way it is
+// written in a container definition, so arguments may contain spaces.
+func parseCommand(value string) ([]string, error) {
+	command := []string{}
+	err := json.Unmarshal([]byte(value), &command)
+	if err != nil || len(command) == 0 {
+		return nil, errors.Errorf(`command must be a JSON array such as ["sh", "-c", "echo hello"]`)
+	}
+	return command, nil
+}
+
+func setEnv(env []*ecs.KeyValuePair, key, value string) []*ecs.KeyValuePair {
+	for _, pair := range env {
+		if aws.StringValue(pair.Name) == key {
+			pair.Value = aws.String(value)
+			return env
+		}
+	}
+	return append(env, &ecs.KeyValuePair{Name: aws.String(key), Value: aws.String(value)})
+}
+
+func setSecret(secrets []*ecs.Secret, key, valueFrom string) []*ecs.Secret {
+	for _, secret := range secrets {
+		if aws.StringValue(secret.Name) == key {
+			secret.ValueFrom = aws.String(valueFrom)
+			return secrets
+		}
+	}
+	return append(secrets, &ecs.Secret{Name: aws.String(key), ValueFrom: aws.String(valueFrom)})
+}
+
+func unsetEnv(env []*ecs.KeyValuePair, key string) []*ecs.KeyValuePair {
+	out := []*ecs.KeyValuePair{}
+	for _, pair := range env {
+		if aws.StringValue(pair.Name) != key {
+			out = append(out, pair)
+		}
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package actions
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fill sets every exported field of a struct to a non zero value.
+func fill(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Ptr:
+			field.Set(reflect.New(field.Type().Elem()))
+		case reflect.Slice:
+			field.Set(reflect.MakeSlice(field.Type(), 1, 1))
+		case reflect.Map:
+			field.Set(reflect.MakeMap(field.Type()))
+		}
+	}
+}
+
+func TestCloneTaskDefinition_CopiesEveryField(t *testing.T) {
+	out := &ecs.DescribeTaskDefinitionOutput{}
+	fill(reflect.ValueOf(out).Elem())
+	fill(reflect.ValueOf(out.TaskDefinition).Elem())
+
+	input := cloneTaskDefinition(out)
+
+	v := reflect.ValueOf(input).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		assert.False(t, v.Field(i).IsZero(), "RegisterTaskDefinitionInput.%s is not copied", field.Name)
+	}
+}
+
+func TestCloneTaskDefinition_SkipsReadOnlyFields(t *testing.T) {
+	family := "web"
+	out := &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecs.TaskDefinition{Family: &family}}
+	out.TaskDefinition.SetRevision(3).SetStatus("ACTIVE").SetTaskDefinitionArn("arn")
+
+	input := cloneTaskDefinition(out)
+	assert.Equal(t, &ecs.RegisterTaskDefinitionInput{Family: &family}, input)
+}
+
+func TestCloneTaskDefinition_Fargate(t *testing.T) {
+	out := &ecs.DescribeTaskDefinitionOutput{}
+	err := jsonutil.UnmarshalJSON(out, strings.NewReader(`{"taskDefinition": {
+		"family": "web",
+		"revision": 3,
+		"requiresCompatibilities": ["FARGATE"],
+		"cpu": "256",
+		"memory": "512",
+		"networkMode": "awsvpc",
+		"executionRoleArn": "arn:aws:iam::123:role/ecsTaskExecutionRole",
+		"containerDefinitions": [{"name": "web", "image": "web:1"}]
+	}}`))
+	assert.Nil(t, err)
+
+	input := cloneTaskDefinition(out)
+	assert.Nil(t, input.Validate())
+	assert.Equal(t, []*string{aws.String("FARGATE")}, input.RequiresCompatibilities)
+	assert.Equal(t, "256", aws.StringValue(input.Cpu))
+	assert.Equal(t, "512", aws.StringValue(input.Memory))
+	assert.Equal(t, "awsvpc", aws.StringValue(input.NetworkMode))
+	assert.Equal(t, "arn:aws:iam::123:role/ecsTaskExecutionRole", aws.StringValue(input.ExecutionRoleArn))
+	assert.Equal(t, "web:1", aws.StringValue(input.ContainerDefinitions[0].Image))
+}
+
+func TestContainerPatch_Apply(t *testing.T) {
+	input := &ecs.RegisterTaskDefinitionInput{
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name: aws.String("web"),
+			Environment: []*ecs.KeyValuePair{
+				{Name: aws.String("A"), Value: aws.String("1")},
+				{Name: aws.String("B"), Value: aws.String("2")},
+			},
+		}},
+	}
+	patch := &containerPatch{
+		Env:      stringList{"web:A=3", "web:C=x=y"},
+		UnsetEnv: stringList{"web:B"},
+		Cpu:      stringList{"web:256"},
+		Memory:   stringList{"web:512"},
+		Command:  stringList{`web:["sh", "-c", "rake db:migrate && rake db:seed"]`},
+		Secret:   stringList{"web:DB_PASSWORD=arn:aws:ssm:us-west-2:123:parameter/db-password"},
+	}
+	assert.Nil(t, patch.apply(input))
+
+	c := input.ContainerDefinitions[0]
+	assert.Equal(t, []*ecs.KeyValuePair{
+		{Name: aws.String("A"), Value: aws.String("3")},
+		{Name: aws.String("C"), Value: aws.String("x=y")},
+	}, c.Environment)
+	assert.Equal(t, int64(256), *c.Cpu)
+	assert.Equal(t, int64(512), *c.Memory)
+	assert.Equal(t, aws.StringSlice([]string{"sh", "-c", "rake db:migrate && rake db:seed"}), c.Command)
+	assert.Equal(t, []*ecs.Secret{{
+		Name:      aws.String("DB_PASSWORD"),
+		ValueFrom: aws.String("arn:aws:ssm:us-west-2:123:parameter/db-password"),
+	}}, c.Secrets)
+}
+
+func TestParseCommand(t *testing.T) {
+	command, err := parseCommand(`["echo", "a b"]`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"echo", "a b"}, command)
+
+	_, err = parseCommand("echo a b")
+	assert.NotNil(t, err)
+	_, err = parseCommand("[]")
+	assert.NotNil(t, err)
+}
+
+func TestContainerPatch_UnknownContainer(t *testing.T) {
+	input := &ecs.RegisterTaskDefinitionInput{}
+	patch := &containerPatch{Env: stringList{"worker:A=1"}}
+	assert.NotNil(t, patch.apply(input))
+}
@@ -0,0 +1,185 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/ghodss/yaml"
+	"github.com/gorhill/cronexpr"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type Validate struct {
+	Globals
+	File    string
+	Vars    stringList
+	VarFile stringList
+}
+
+func (cmd *Validate) ShortDescription() string { return "Validate resource files" }
+
+func (cmd *Validate) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.File, "f", "", "File or directory to validate")
+	fs.Var(&cmd.Vars, "var", "Set a template variable as <name>=<value>, may be repeated")
+	fs.Var(&cmd.VarFile, "var-file", "Yaml file of template variables, may be repeated")
+}
+
+func (cmd *Validate) Run(w io.Writer) error {
+	vars, err := loadVars(cmd.VarFile, cmd.Vars)
+	if err != nil {
+		return err
+	}
+	specs, err := readSpecs(cmd.File, vars)
+	if err != nil {
+		return err
+	}
+	if err := validateSpecs(w, specs); err != nil {
+		return err
+	}
+	io.WriteString(w, fmt.Sprintf("%d resources are valid\n", len(specs)))
+	return nil
+}
+
+// validateSpecs writes every problem found in the specs and returns an error
+// when there are any.
+func validateSpecs(w io.Writer, specs []*Spec) error {
+	count := 0
+	for _, spec := range specs {
+		for _, problem := range validateSpec(spec) {
+			io.WriteString(w, problem.Error()+"\n")
+			count++
+		}
+	}
+	if count > 0 {
+		return errors.Errorf("Found %d problems", count)
+	}
+	return nil
+}
+
+type specError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *specError) Error() string { return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message) }
+
+// validateSpec checks a spec offline. Unknown fields are rejected and the
+// spec is checked with the SDK validation of the matching input.
+func validateSpec(spec *Spec) []*specError {
+	problems := []*specError{}
+	report := func(field string, msg string, args ...interface{}) {
+		problems = append(problems, &specError{
+			File:    spec.File,
+			Line:    spec.fieldLine(field),
+			Message: fmt.Sprintf(msg, args...),
+		})
+	}
+
+	doc, err := yaml.YAMLToJSON(spec.doc)
+	if err == nil {
+		err = decodeStrict(doc, &Spec{})
+	}
+	if err != nil {
+		report(unknownField(err), "%v", err)
+	}
+	if spec.ID == "" {
+		report("id", "id is required")
+	}
+
+	r, err := newResource(spec.Type, &resourceClients{})
+	if err != nil {
+		report("type", "%v", err)
+		return problems
+	}
+	input := r.Input()
+
+	err = decodeStrict(spec.Spec, input)
+	if err != nil {
+		report(unknownField(err), "%v", err)
+		return problems
+	}
+
+	if v, ok := input.(request.Validator); ok {
+		if err, ok := v.Validate().(request.ErrInvalidParams); ok {
+			for _, e := range err.OrigErrs() {
+				param := e.(request.ErrInvalidParam)
+				// Fields are prefixed with the name of the input.
+				context := param.Field()[:strings.Index(param.Field(), ".")+1]
+				field := strings.TrimPrefix(param.Field(), context)
+				report("spec."+field, "%s", strings.Replace(param.Message(), context, "", 1))
+			}
+		}
+	}
+
+	if job, ok := input.(*cronJob); ok {
+		if job.TaskDefinitionID == "" {
+			report("TaskDefinitionID", "TaskDefinitionID is required")
+		}
+		if _, err := cronexpr.Parse(job.Schedule); err != nil {
+			report("Schedule", "Invalid schedule %q -- %v", job.Schedule, err)
+		}
+		if job.MisfirePolicy != "" && !misfirePolicies[job.MisfirePolicy] {
+			report("MisfirePolicy", "MisfirePolicy must be one of skip, runOnce or runAll")
+		}
+		if job.ConcurrencyPolicy != "" && !concurrencyPolicies[job.ConcurrencyPolicy] {
+			report("ConcurrencyPolicy", "ConcurrencyPolicy must be one of Allow, Forbid or Replace")
+		}
+		if job.MisfireLimit < 0 {
+			report("MisfireLimit", "MisfireLimit must not be negative")
+		}
+		if job.StartingDeadlineSeconds < 0 {
+			report("StartingDeadlineSeconds", "StartingDeadlineSeconds must not be negative")
+		}
+	}
+	return problems
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+var unknownFieldPattern = regexp.MustCompile(`unknown field "([^"]+)"`)
+
+// unknownField finds the field a decode error refers to.
+func unknownField(err error) string {
+	if m := unknownFieldPattern.FindStringSubmatch(err.Error()); m != nil {
+		return m[1]
+	}
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		return typeErr.Field
+	}
+	return ""
+}
+
+var indexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// fieldLine finds the line of the deepest key of a field path such as
+// ContainerDefinitions[0].Name in the yaml document. Fields that are not in
+// the document, such as missing required fields, resolve to their parent.
+func (spec *Spec) fieldLine(field string) int {
+	parts := strings.Split(indexPattern.ReplaceAllString(field, ""), ".")
+	lines := strings.Split(string(spec.doc), "\n")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if parts[i] == "" {
+			continue
+		}
+		key := regexp.MustCompile(`(?i)^[\s-]*["']?` + regexp.QuoteMeta(parts[i]) + `["']?\s*:`)
+		for n, line := range lines {
+			if key.MatchString(line) {
+				return spec.Line + n
+			}
+		}
+	}
+	return spec.Line
+}
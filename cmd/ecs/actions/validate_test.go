@@ -0,0 +1,89 @@
+package actions
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func readTestSpecs(t *testing.T, data string) []*Spec {
+	f, err := ioutil.TempFile("", "spec")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString(data)
+	f.Close()
+
+	specs, err := readSpecFile(f.Name(), nil)
+	assert.Nil(t, err)
+	for _, spec := range specs {
+		spec.File = "test.yml"
+	}
+	return specs
+}
+
+func TestValidateSpec_Valid(t *testing.T) {
+	specs := readTestSpecs(t, `type: TaskDefinition
+id: web
+spec:
+  family: web
+  containerDefinitions:
+  - name: web
+    image: web
+    memory: 300
+---
+type: CronJob
+id: cleanup
+spec:
+  TaskDefinitionID: cleanup
+  Schedule: "0 * * * *"
+`)
+	for _, spec := range specs {
+		assert.Empty(t, validateSpec(spec))
+	}
+}
+
+func TestValidateSpec_UnknownField(t *testing.T) {
+	specs := readTestSpecs(t, `type: TaskDefinition
+id: web
+spec:
+  family: web
+  containerDefinitions:
+  - name: web
+    image: web
+    memroy: 300
+`)
+	problems := validateSpec(specs[0])
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, `test.yml:8: json: unknown field "memroy"`, problems[0].Error())
+}
+
+func TestValidateSpec_SDKValidation(t *testing.T) {
+	specs := readTestSpecs(t, `---
+type: TaskDefinition
+id: web
+spec:
+  containerDefinitions:
+  - name: web
+    image: web
+`)
+	problems := validateSpec(specs[0])
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, "test.yml:4: missing required field, Family.", problems[0].Error())
+}
+
+func TestValidateSpec_CronJob(t *testing.T) {
+	specs := readTestSpecs(t, `type: CronJob
+spec:
+  TaskDefinitionID: cleanup
+  Schedule: "not a schedule"
+  MisfirePolicy: sometimes
+  ConcurrencyPolicy: Never
+`)
+	problems := validateSpec(specs[0])
+	assert.Equal(t, 4, len(problems))
+	assert.Equal(t, "test.yml:1: id is required", problems[0].Error())
+	assert.Contains(t, problems[1].Error(), "test.yml:4: Invalid schedule")
+	assert.Equal(t, "test.yml:5: MisfirePolicy must be one of skip, runOnce or runAll", problems[2].Error())
+	assert.Equal(t, "test.yml:6: ConcurrencyPolicy must be one of Allow, Forbid or Replace", problems[3].Error())
+}
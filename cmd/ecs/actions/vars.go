@@ -0,0 +1,102 @@
+package actions
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches ${name} and the escaped form $${name}.
+var varPattern = regexp.MustCompile(`\$?\$\{([A-Za-z0-9_.-]+)\}`)
+
+// loadVars reads the variable files in order and then applies the key=value
+// pairs, later values override earlier ones.
+func loadVars(files []string, pairs []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not read var file")
+		}
+		// Scalars are decoded as their original text, so 1.10 and
+		// 123456789012 are not turned into floats.
+		values := map[string]string{}
+		err = yaml.Unmarshal(data, &values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not decode var file %s", file)
+		}
+		for k, v := range values {
+			vars[k] = v
+		}
+	}
+
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("Variables must be described as <name>=<value>, received: %s", pair)
+		}
+		vars[parts[0]] = parts[1]
+	}
+	return vars, nil
+}
+
+// expandVars replaces every ${name} in the data with its value, $${name} is
+// left as the literal ${name}. Undefined variables are an error. Comments are
+// left as they are.
+func expandVars(data []byte, vars map[string]string) ([]byte, error) {
+	missing := map[string]bool{}
+	expand := func(match []byte) []byte {
+		if match[1] == '$' {
+			return match[1:]
+		}
+		name := string(match[2 : len(match)-1])
+		value, ok := vars[name]
+		if !ok {
+			missing[name] = true
+			return match
+		}
+		return []byte(value)
+	}
+
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	out := make([]byte, 0, len(data))
+	for _, line := range lines {
+		i := commentStart(line)
+		out = append(out, varPattern.ReplaceAllFunc(line[:i], expand)...)
+		out = append(out, line[i:]...)
+	}
+
+	if len(missing) > 0 {
+		names := []string{}
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, errors.Errorf("Undefined variables: %s", strings.Join(names, ", "))
+	}
+	return out, nil
+}
+
+// commentStart returns the index a yaml comment starts at in the line, or the
+// length of the line. A # only starts a comment outside of quotes and at the
+// start of the line or after whitespace.
+func commentStart(line []byte) int {
+	var quote byte
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return i
+		}
+	}
+	return len(line)
+}
@@ -0,0 +1,58 @@
+package actions
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	out, err := expandVars([]byte("cluster: ${cluster}\ntag: $${cluster}\nhome: $HOME\n"), map[string]string{
+		"cluster": "prod",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "cluster: prod\ntag: ${cluster}\nhome: $HOME\n", string(out))
+}
+
+func TestExpandVars_Comments(t *testing.T) {
+	out, err := expandVars([]byte("# uses ${image}\nimage: \"${image}\" # ${old}\nurl: \"http://x/#${image}\"\n"), map[string]string{
+		"image": "web:2",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "# uses ${image}\nimage: \"web:2\" # ${old}\nurl: \"http://x/#web:2\"\n", string(out))
+}
+
+func TestExpandVars_Undefined(t *testing.T) {
+	_, err := expandVars([]byte("cluster: ${cluster}\nimage: ${image}\n"), map[string]string{})
+	assert.EqualError(t, err, "Undefined variables: cluster, image")
+}
+
+func TestLoadVars(t *testing.T) {
+	f, err := ioutil.TempFile("", "vars")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("cluster: staging\ncount: 3\n")
+	f.Close()
+
+	vars, err := loadVars([]string{f.Name()}, []string{"cluster=prod"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"cluster": "prod", "count": "3"}, vars)
+}
+
+func TestLoadVars_KeepsScalarText(t *testing.T) {
+	f, err := ioutil.TempFile("", "vars")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("account: 123456789012\nversion: 1.10\nenabled: yes\nempty:\n")
+	f.Close()
+
+	vars, err := loadVars([]string{f.Name()}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"account": "123456789012",
+		"version": "1.10",
+		"enabled": "yes",
+		"empty":   "",
+	}, vars)
+}
@@ -1,59 +1,188 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/coldog/tool-ecs/cmd/ecs/actions"
+	"github.com/pkg/errors"
 	"io"
 	"os"
+	"sort"
+	"strings"
 )
 
-type Cmd interface {
-	ShortDescription() string
-	ParseArgs(args []string)
-	PrintUsage()
-	Run(w io.Writer) error
+// Exit codes shared by every command, a task run by `ecs run -wait` exits with
+// the code of the task instead.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is a node of the command tree, either an action or a group of
+// subcommands.
+type command struct {
+	name        string
+	description string
+	action      actions.Command
+	commands    []*command
 }
 
-var commands = map[string]Cmd{
-	"apply":  &actions.Apply{},
-	"remove": &actions.Remove{},
-	"scale":  &actions.Scale{},
-	"deploy": &actions.Deploy{},
+func (c *command) find(name string) *command {
+	for _, sub := range c.commands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
 }
 
-func printUsages() {
-	fmt.Println("ECS cli")
-	for name, cmd := range commands {
-		fmt.Println("  -", name, cmd.ShortDescription())
+func (c *command) short() string {
+	if c.action != nil {
+		return c.action.ShortDescription()
 	}
+	return c.description
 }
 
-func main() {
-	if len(os.Args) <= 1 {
-		printUsages()
-		return
+func newRoot() *command {
+	root := &command{name: "ecs", description: "ECS cli"}
+	for name, action := range map[string]actions.Command{
+		"apply":    &actions.Apply{},
+		"remove":   &actions.Remove{},
+		"run":      &actions.Run{},
+		"scale":    &actions.Scale{},
+		"ssh":      &actions.SSH{},
+		"status":   &actions.Status{},
+		"deploy":   &actions.Deploy{},
+		"diff":     &actions.Diff{},
+		"get":      &actions.Get{},
+		"describe": &actions.Describe{},
+		"export":   &actions.Export{},
+		"exec":     &actions.Exec{},
+		"logs":     &actions.Logs{},
+		"rollback": &actions.Rollback{},
+		"validate": &actions.Validate{},
+	} {
+		root.commands = append(root.commands, &command{name: name, action: action})
 	}
+	root.commands = append(root.commands, &command{
+		name:        "context",
+		description: "Manage the contexts in ~/.ecs-toolkit/config.yml",
+		commands: []*command{
+			{name: "list", action: &actions.ContextList{}},
+			{name: "use", action: &actions.ContextUse{}},
+		},
+	})
+	root.commands = append(root.commands, &command{
+		name:        "completion",
+		description: "Print shell completions",
+		commands: []*command{
+			{name: "bash", action: &completion{root: root}},
+			{name: "zsh", action: &completion{root: root, zsh: true}},
+		},
+	})
+	sort.Slice(root.commands, func(i, j int) bool { return root.commands[i].name < root.commands[j].name })
+	return root
+}
 
-	arg := os.Args[1]
-	cmd, ok := commands[arg]
-	if !ok {
-		fmt.Println("Command not recognized", arg)
-		printUsages()
-		os.Exit(1)
-		return
+// run dispatches the arguments to a command and returns the exit code.
+func run(root *command, args []string, stdout, stderr io.Writer) int {
+	node := root
+	path := []string{root.name}
+	help := false
+	global := []string{}
+	for node.action == nil && len(args) > 0 {
+		if isHelp(args[0]) {
+			help = true
+			args = args[1:]
+			continue
+		}
+		// Global flags may come before the command, they all take a value.
+		if strings.HasPrefix(args[0], "-") {
+			n := 2
+			if strings.Contains(args[0], "=") || len(args) == 1 {
+				n = 1
+			}
+			global = append(global, args[:n]...)
+			args = args[n:]
+			continue
+		}
+		sub := node.find(args[0])
+		if sub == nil {
+			fmt.Fprintf(stderr, "Unknown command: %s\n\n", args[0])
+			printUsage(stderr, node, path)
+			return exitUsage
+		}
+		node = sub
+		path = append(path, sub.name)
+		args = args[1:]
 	}
 
-	cmd.ParseArgs(os.Args[2:])
+	if node.action == nil {
+		if help || node == root {
+			printUsage(stdout, node, path)
+			return exitOK
+		}
+		printUsage(stderr, node, path)
+		return exitUsage
+	}
+	if help || (len(args) == 1 && args[0] == "help") {
+		printUsage(stdout, node, path)
+		return exitOK
+	}
 
-	if len(os.Args) >= 3 && os.Args[2] == "help" {
-		cmd.PrintUsage()
-		return
+	fs := actions.NewFlagSet(strings.Join(path, " "), node.action)
+	err := actions.ParseArgs(fs, node.action, append(global, args...))
+	if err == flag.ErrHelp {
+		printUsage(stdout, node, path)
+		return exitOK
+	}
+	if _, ok := err.(*actions.UsageError); ok {
+		fmt.Fprintf(stderr, "%s\n\n", err)
+		printUsage(stderr, node, path)
+		return exitUsage
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return exitError
 	}
 
-	err := cmd.Run(os.Stdout)
+	err = node.action.Run(stdout)
 	if err != nil {
-		fmt.Printf("%s\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "%s\n", err)
+		if exit, ok := errors.Cause(err).(*actions.ExitError); ok {
+			return exit.Code
+		}
+		return exitError
+	}
+	return exitOK
+}
+
+func isHelp(arg string) bool {
+	return arg == "help" || arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func printUsage(w io.Writer, node *command, path []string) {
+	name := strings.Join(path, " ")
+	if node.action == nil {
+		fmt.Fprintf(w, "Usage: %s <command> [flags]\n\n%s\n\nCommands:\n", name, node.short())
+		for _, sub := range node.commands {
+			fmt.Fprintf(w, "  %-12s %s\n", sub.name, sub.short())
+		}
+		fmt.Fprintf(w, "\nRun '%s help <command>' for the flags of a command.\n", name)
 		return
 	}
+
+	usage := "Usage: " + name + " [flags]"
+	if c, ok := node.action.(actions.ArgsCommand); ok {
+		usage += " " + c.ArgsUsage()
+	}
+	fmt.Fprintf(w, "%s\n\n%s\n\nFlags:\n", usage, node.short())
+	fs := actions.NewFlagSet(name, node.action)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+func main() {
+	os.Exit(run(newRoot(), os.Args[1:], os.Stdout, os.Stderr))
 }
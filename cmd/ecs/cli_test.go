@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"github.com/coldog/tool-ecs/cmd/ecs/actions"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+type testAction struct {
+	actions.Globals
+	Name string
+	err  error
+	ran  bool
+}
+
+func (cmd *testAction) ShortDescription() string { return "Test action" }
+func (cmd *testAction) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.Name, "name", "", "Name")
+}
+func (cmd *testAction) Run(w io.Writer) error {
+	cmd.ran = true
+	return cmd.err
+}
+
+func testRoot(action *testAction) *command {
+	return &command{name: "ecs", commands: []*command{
+		{name: "group", description: "A group", commands: []*command{
+			{name: "action", action: action},
+		}},
+	}}
+}
+
+func TestRun(t *testing.T) {
+	action := &testAction{}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(testRoot(action), []string{"-region", "eu-west-1", "group", "action", "-name", "x"}, stdout, stderr)
+	assert.Equal(t, exitOK, code)
+	assert.True(t, action.ran)
+	assert.Equal(t, "x", action.Name)
+	assert.Equal(t, "eu-west-1", action.Region)
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	assert.Equal(t, exitUsage, run(testRoot(&testAction{}), []string{"missing"}, stdout, stderr))
+	assert.Contains(t, stderr.String(), "Unknown command: missing")
+
+	assert.Equal(t, exitUsage, run(testRoot(&testAction{}), []string{"group"}, stdout, stderr))
+	assert.Equal(t, exitUsage, run(testRoot(&testAction{}), []string{"group", "action", "extra"}, stdout, stderr))
+	assert.Equal(t, exitUsage, run(testRoot(&testAction{}), []string{"group", "action", "-bad"}, stdout, stderr))
+
+	action := &testAction{err: errors.New("failed")}
+	assert.Equal(t, exitError, run(testRoot(action), []string{"group", "action"}, stdout, stderr))
+
+	action = &testAction{err: errors.Wrap(&actions.ExitError{Code: 3, Message: "exit 3"}, "task")}
+	assert.Equal(t, 3, run(testRoot(action), []string{"group", "action"}, stdout, stderr))
+}
+
+func TestRun_Help(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"help"},
+		{"help", "group", "action"},
+		{"group", "action", "help"},
+		{"group", "action", "-h"},
+	} {
+		action := &testAction{}
+		stdout := &bytes.Buffer{}
+		assert.Equal(t, exitOK, run(testRoot(action), args, stdout, &bytes.Buffer{}), "%v", args)
+		assert.Contains(t, stdout.String(), "Usage: ecs", "%v", args)
+		assert.False(t, action.ran)
+	}
+
+	stdout := &bytes.Buffer{}
+	run(testRoot(&testAction{}), []string{"help", "group", "action"}, stdout, &bytes.Buffer{})
+	assert.Contains(t, stdout.String(), "Usage: ecs group action [flags]")
+	assert.Contains(t, stdout.String(), "-name")
+	assert.Contains(t, stdout.String(), "-region")
+}
+
+func TestCompletion(t *testing.T) {
+	root := newRoot()
+	buf := &bytes.Buffer{}
+	assert.Equal(t, exitOK, run(root, []string{"completion", "bash"}, buf, &bytes.Buffer{}))
+	assert.Contains(t, buf.String(), `" completion bash"`)
+	assert.Contains(t, buf.String(), `" deploy") opts="`)
+	assert.Regexp(t, `" get"\) opts="[^"]*-output`, buf.String())
+	assert.Contains(t, buf.String(), "complete -o default -F _ecs ecs")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/coldog/tool-ecs/cmd/ecs/actions"
+	"io"
+	"strings"
+)
+
+// completion prints a completion script generated from the command tree.
+type completion struct {
+	actions.Globals
+	root *command
+	zsh  bool
+}
+
+func (cmd *completion) ShortDescription() string {
+	if cmd.zsh {
+		return "Print zsh completions, source with: source <(ecs completion zsh)"
+	}
+	return "Print bash completions, source with: source <(ecs completion bash)"
+}
+
+func (cmd *completion) Flags(fs *flag.FlagSet) {}
+
+func (cmd *completion) Run(w io.Writer) error {
+	paths := []string{}
+	cases := []string{}
+	var walk func(node *command, path string)
+	walk = func(node *command, path string) {
+		words := []string{}
+		if node.action == nil {
+			for _, sub := range node.commands {
+				words = append(words, sub.name)
+				walk(sub, path+" "+sub.name)
+			}
+		} else {
+			actions.NewFlagSet(path, node.action).VisitAll(func(f *flag.Flag) {
+				words = append(words, "-"+f.Name)
+			})
+		}
+		if path != "" {
+			paths = append(paths, fmt.Sprintf("%q", path))
+		}
+		cases = append(cases, fmt.Sprintf("    %q) opts=%q ;;", path, strings.Join(words, " ")))
+	}
+	walk(cmd.root, "")
+
+	if cmd.zsh {
+		io.WriteString(w, "autoload -U +X bashcompinit && bashcompinit\n")
+	}
+	io.WriteString(w, fmt.Sprintf(`_ecs() {
+  local cur="${COMP_WORDS[COMP_CWORD]}" cmdpath="" opts="" i
+  for ((i=1; i<COMP_CWORD; i++)); do
+    case "${cmdpath} ${COMP_WORDS[i]}" in
+      %s) cmdpath="${cmdpath} ${COMP_WORDS[i]}" ;;
+    esac
+  done
+  case "${cmdpath}" in
+%s
+  esac
+  COMPREPLY=($(compgen -W "${opts}" -- "${cur}"))
+}
+complete -o default -F _ecs ecs
+`, strings.Join(paths, "|"), strings.Join(cases, "\n")))
+	return nil
+}
@@ -1,28 +1,66 @@
 package kv
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"sync"
-	"fmt"
-	"context"
+	"time"
 )
 
+// ErrNotFound is returned by Get when no value is stored under the key.
+var ErrNotFound = errors.New("kv: not found")
+
+// ErrConflict is returned by PutVersion when the stored version has changed.
+var ErrConflict = errors.New("kv: version conflict")
+
 type DB interface {
 	Put(ctx context.Context, class string, key string, i interface{}) error
 	Get(ctx context.Context, class string, key string, i interface{}) error
 	Del(ctx context.Context, class string, key string) error
 	Keys(ctx context.Context, class string) ([]string, error)
+
+	// GetVersion is Get that also returns the version of the value. Every
+	// write increments the version.
+	GetVersion(ctx context.Context, class string, key string, i interface{}) (int64, error)
+	// PutVersion stores the value only if the stored version is still
+	// version, 0 stores it only if the key does not exist yet. It returns
+	// ErrConflict otherwise.
+	PutVersion(ctx context.Context, class string, key string, i interface{}, version int64) error
+
+	// Acquire takes the named lease for owner or renews it when owner already
+	// holds it. It returns false while another owner holds an unexpired lease.
+	Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// Release gives up the lease if owner holds it.
+	Release(ctx context.Context, name, owner string) error
 }
 
+// LeaseClass is the class leases are stored under.
+const LeaseClass = "Lease"
+
+var now = time.Now
+
 func NewLocalDB() *LocalDB {
 	return &LocalDB{
-		data: map[string]map[string][]byte{},
+		data:   map[string]map[string]*item{},
+		leases: map[string]lease{},
 	}
 }
 
 type LocalDB struct {
-	lock sync.RWMutex
-	data map[string]map[string][]byte
+	lock   sync.RWMutex
+	data   map[string]map[string]*item
+	leases map[string]lease
+}
+
+type item struct {
+	data    []byte
+	version int64
+}
+
+type lease struct {
+	owner   string
+	expires time.Time
 }
 
 func (db *LocalDB) Keys(ctx context.Context, class string) ([]string, error) {
@@ -36,31 +74,59 @@ func (db *LocalDB) Keys(ctx context.Context, class string) ([]string, error) {
 }
 
 func (db *LocalDB) Put(ctx context.Context, class, key string, i interface{}) error {
-	db.lock.RLock()
-	defer db.lock.RUnlock()
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return db.put(class, key, i)
+}
+
+func (db *LocalDB) PutVersion(ctx context.Context, class, key string, i interface{}, version int64) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	var current int64
+	if it, ok := db.data[class][key]; ok {
+		current = it.version
+	}
+	if current != version {
+		return ErrConflict
+	}
+	return db.put(class, key, i)
+}
+
+func (db *LocalDB) put(class, key string, i interface{}) error {
 	data, err := json.Marshal(i)
 	if err != nil {
 		return err
 	}
 	if db.data[class] == nil {
-		db.data[class] = map[string][]byte{}
+		db.data[class] = map[string]*item{}
+	}
+	it := db.data[class][key]
+	if it == nil {
+		it = &item{}
+		db.data[class][key] = it
 	}
-	db.data[class][key] = data
+	it.data = data
+	it.version++
 	return nil
 }
 
 func (db *LocalDB) Get(ctx context.Context, class, key string, i interface{}) error {
-	db.lock.Lock()
-	defer db.lock.Unlock()
-	inner := db.data[class]
-	if inner == nil {
-		return fmt.Errorf("ErrNotFound: %s(%s)", class, key)
+	_, err := db.GetVersion(ctx, class, key, i)
+	return err
+}
+
+func (db *LocalDB) GetVersion(ctx context.Context, class, key string, i interface{}) (int64, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	it, ok := db.data[class][key]
+	if !ok {
+		return 0, ErrNotFound
 	}
-	err := json.Unmarshal(inner[key], i)
+	err := json.Unmarshal(it.data, i)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return it.version, nil
 }
 
 func (db *LocalDB) Del(ctx context.Context, class, key string) error {
@@ -73,3 +139,23 @@ func (db *LocalDB) Del(ctx context.Context, class, key string) error {
 	delete(inner, key)
 	return nil
 }
+
+func (db *LocalDB) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	current, ok := db.leases[name]
+	if ok && current.owner != owner && now().Before(current.expires) {
+		return false, nil
+	}
+	db.leases[name] = lease{owner: owner, expires: now().Add(ttl)}
+	return true, nil
+}
+
+func (db *LocalDB) Release(ctx context.Context, name, owner string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.leases[name].owner == owner {
+		delete(db.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package kv
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLocalDB_Lease(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2017, 05, 05, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	db := NewLocalDB()
+	ok, err := db.Acquire(ctx, "lease", "a", 30*time.Second)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// Held by a until it expires, a may renew it.
+	ok, _ = db.Acquire(ctx, "lease", "b", 30*time.Second)
+	assert.False(t, ok)
+	clock = clock.Add(20 * time.Second)
+	ok, _ = db.Acquire(ctx, "lease", "a", 30*time.Second)
+	assert.True(t, ok)
+	clock = clock.Add(20 * time.Second)
+	ok, _ = db.Acquire(ctx, "lease", "b", 30*time.Second)
+	assert.False(t, ok)
+
+	clock = clock.Add(11 * time.Second)
+	ok, _ = db.Acquire(ctx, "lease", "b", 30*time.Second)
+	assert.True(t, ok)
+
+	// Only the owner can release.
+	assert.Nil(t, db.Release(ctx, "lease", "a"))
+	ok, _ = db.Acquire(ctx, "lease", "a", 30*time.Second)
+	assert.False(t, ok)
+	assert.Nil(t, db.Release(ctx, "lease", "b"))
+	ok, _ = db.Acquire(ctx, "lease", "a", 30*time.Second)
+	assert.True(t, ok)
+}
+
+func TestLocalDB_PutVersion(t *testing.T) {
+	ctx := context.Background()
+	db := NewLocalDB()
+
+	assert.Nil(t, db.PutVersion(ctx, "class", "key", "a", 0))
+	assert.Equal(t, ErrConflict, db.PutVersion(ctx, "class", "key", "b", 0))
+
+	var value string
+	version, err := db.GetVersion(ctx, "class", "key", &value)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), version)
+
+	// A plain put also moves the version on.
+	assert.Nil(t, db.Put(ctx, "class", "key", "c"))
+	assert.Equal(t, ErrConflict, db.PutVersion(ctx, "class", "key", "d", version))
+	assert.Nil(t, db.PutVersion(ctx, "class", "key", "d", version+1))
+
+	db.Get(ctx, "class", "key", &value)
+	assert.Equal(t, "d", value)
+}
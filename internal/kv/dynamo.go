@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+	"time"
 )
 
 const table = "sked_objects"
@@ -53,15 +56,52 @@ func (db *DynamoDB) Put(ctx context.Context, class, key string, i interface{}) e
 	if err != nil {
 		return err
 	}
-	put := &dynamodb.PutItemInput{
+	update := &dynamodb.UpdateItemInput{
 		TableName: aws.String(table),
-		Item: map[string]*dynamodb.AttributeValue{
-			"body":  {B: data},
+		Key: map[string]*dynamodb.AttributeValue{
 			"key":   {S: aws.String(key)},
 			"class": {S: aws.String(class)},
 		},
+		UpdateExpression:         aws.String("SET #body = :body ADD #version :one"),
+		ExpressionAttributeNames: map[string]*string{"#body": aws.String("body"), "#version": aws.String("version")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":body": {B: data},
+			":one":  {N: aws.String("1")},
+		},
+	}
+	_, err = db.Client.UpdateItemWithContext(ctx, update)
+	return err
+}
+
+// PutVersion writes the item with a condition on the version attribute.
+// Items written before versions were stored count as version 0.
+func (db *DynamoDB) PutVersion(ctx context.Context, class, key string, i interface{}, version int64) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	put := &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"body":    {B: data},
+			"key":     {S: aws.String(key)},
+			"class":   {S: aws.String(class)},
+			"version": {N: aws.String(strconv.FormatInt(version+1, 10))},
+		},
+		ExpressionAttributeNames: map[string]*string{"#version": aws.String("version")},
+	}
+	if version == 0 {
+		put.ConditionExpression = aws.String("attribute_not_exists(#version)")
+	} else {
+		put.ConditionExpression = aws.String("#version = :version")
+		put.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":version": {N: aws.String(strconv.FormatInt(version, 10))},
+		}
 	}
 	_, err = db.Client.PutItemWithContext(ctx, put)
+	if isConditionFailed(err) {
+		return ErrConflict
+	}
 	return err
 }
 
@@ -72,20 +112,29 @@ func (db *DynamoDB) Keys(ctx context.Context, class string) ([]string, error) {
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":class": {S: aws.String(class)},
 		},
-		ProjectionExpression: aws.String("class"),
+		// "key" is a reserved word in DynamoDB expressions.
+		ProjectionExpression:     aws.String("#key"),
+		ExpressionAttributeNames: map[string]*string{"#key": aws.String("key")},
 	}
-	res, err := db.Client.QueryWithContext(ctx, query)
+	keys := []string{}
+	err := db.Client.QueryPagesWithContext(ctx, query, func(res *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range res.Items {
+			keys = append(keys, *item["key"].S)
+		}
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
-	keys := []string{}
-	for _, item := range res.Items {
-		keys = append(keys, *item["class"].S)
-	}
 	return keys, nil
 }
 
 func (db *DynamoDB) Get(ctx context.Context, class, key string, i interface{}) error {
+	_, err := db.GetVersion(ctx, class, key, i)
+	return err
+}
+
+func (db *DynamoDB) GetVersion(ctx context.Context, class, key string, i interface{}) (int64, error) {
 	get := &dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(true),
 		TableName:      aws.String(table),
@@ -95,12 +144,25 @@ func (db *DynamoDB) Get(ctx context.Context, class, key string, i interface{}) e
 		},
 	}
 	res, err := db.Client.GetItemWithContext(ctx, get)
+	if err != nil {
+		return 0, err
+	}
+	if res.Item["body"] == nil {
+		return 0, ErrNotFound
+	}
 	data := res.Item["body"].B
 	err = json.Unmarshal(data, i)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	var version int64
+	if v := res.Item["version"]; v != nil && v.N != nil {
+		version, err = strconv.ParseInt(*v.N, 10, 64)
+		if err != nil {
+			return 0, err
+		}
 	}
-	return nil
+	return version, nil
 }
 
 func (db *DynamoDB) Del(ctx context.Context, class, key string) error {
@@ -114,3 +176,56 @@ func (db *DynamoDB) Del(ctx context.Context, class, key string) error {
 	_, err := db.Client.DeleteItemWithContext(ctx, get)
 	return err
 }
+
+// Acquire writes the lease with a condition so that only one owner can hold
+// it until it expires. Expiry uses the clocks of the owners, the ttl should
+// be well above the expected clock skew.
+func (db *DynamoDB) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	t := now()
+	put := &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"key":     {S: aws.String(name)},
+			"class":   {S: aws.String(LeaseClass)},
+			"owner":   {S: aws.String(owner)},
+			"expires": {N: aws.String(strconv.FormatInt(t.Add(ttl).UnixNano(), 10))},
+		},
+		ConditionExpression:      aws.String("attribute_not_exists(#key) OR #owner = :owner OR #expires < :now"),
+		ExpressionAttributeNames: map[string]*string{"#key": aws.String("key"), "#owner": aws.String("owner"), "#expires": aws.String("expires")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(owner)},
+			":now":   {N: aws.String(strconv.FormatInt(t.UnixNano(), 10))},
+		},
+	}
+	_, err := db.Client.PutItemWithContext(ctx, put)
+	if isConditionFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (db *DynamoDB) Release(ctx context.Context, name, owner string) error {
+	del := &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key":   {S: aws.String(name)},
+			"class": {S: aws.String(LeaseClass)},
+		},
+		ConditionExpression:       aws.String("#owner = :owner"),
+		ExpressionAttributeNames:  map[string]*string{"#owner": aws.String("owner")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":owner": {S: aws.String(owner)}},
+	}
+	_, err := db.Client.DeleteItemWithContext(ctx, del)
+	if isConditionFailed(err) {
+		return nil
+	}
+	return err
+}
+
+func isConditionFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}